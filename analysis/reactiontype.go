@@ -14,10 +14,22 @@ const (
 	Expanding
 )
 
-// Determines the type of the reaction based on the number of inputs and outputs it has
+// Determines the type of the reaction based on the number of inputs and outputs it has.
+// If the reaction has alternative outcomes of different types, then the reaction is considered to be constant.
 func DetermineReactionType(reaction *ast.Reaction) ReactionType {
-	inputs := len(reaction.Input.Idents)
-	outputs := len(reaction.Action.Products)
+	reactionType := determineActionType(reaction, reaction.Action)
+	for _, alt := range reaction.Alternatives {
+		if determineActionType(reaction, alt.Action) != reactionType {
+			return Constant
+		}
+	}
+	return reactionType
+}
+
+// Determines the type of a single outcome of a reaction
+func determineActionType(reaction *ast.Reaction, action *ast.ReactionAction) ReactionType {
+	inputs := len(reaction.Input.Patterns)
+	outputs := len(action.Products)
 
 	if inputs > outputs {
 		return Shrinking
@@ -27,3 +39,18 @@ func DetermineReactionType(reaction *ast.Reaction) ReactionType {
 		return Constant
 	}
 }
+
+// Determines the type of a group of reactions (including any fallback groups).
+// If every reaction in the group is of the same type, then the group is also of that type, otherwise
+// the group is considered to be constant.
+func DetermineGroupType(group *ast.ReactionGroup) ReactionType {
+	groupType := DetermineReactionType(group.Reactions[0])
+	for ; group != nil; group = group.Fallback {
+		for _, reaction := range group.Reactions {
+			if DetermineReactionType(reaction) != groupType {
+				return Constant
+			}
+		}
+	}
+	return groupType
+}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -9,7 +10,7 @@ import (
 type ArithmeticExp struct {
 	left         IntegerTerm
 	right        IntegerTerm
-	operator     func(left int, right int) int
+	operator     func(left int, right int) (int, error)
 	operatorName string
 }
 
@@ -24,7 +25,11 @@ func (a ArithmeticExp) Eval(state State) (int, error) {
 		return 0, err
 	}
 
-	return a.operator(l, r), nil
+	return a.operator(l, r)
+}
+
+func (a ArithmeticExp) Substitute(s Substitution) IntegerTerm {
+	return ArithmeticExp{a.left.Substitute(s), a.right.Substitute(s), a.operator, a.operatorName}
 }
 
 func (a ArithmeticExp) String() string {
@@ -56,22 +61,181 @@ func Modulo(left IntegerTerm, right IntegerTerm) ArithmeticExp {
 	return ArithmeticExp{left, right, modulo, "modulo"}
 }
 
-func plus(left int, right int) int {
-	return left + right
+// Returns a 'power' arithmetic expression between the two given terms
+func Power(left IntegerTerm, right IntegerTerm) ArithmeticExp {
+	return ArithmeticExp{left, right, power, "power"}
+}
+
+// Returns a 'bitwise and' arithmetic expression between the two given terms
+func BitwiseAnd(left IntegerTerm, right IntegerTerm) ArithmeticExp {
+	return ArithmeticExp{left, right, bitwiseAnd, "bitwiseAnd"}
+}
+
+// Returns a 'bitwise or' arithmetic expression between the two given terms
+func BitwiseOr(left IntegerTerm, right IntegerTerm) ArithmeticExp {
+	return ArithmeticExp{left, right, bitwiseOr, "bitwiseOr"}
+}
+
+// Returns a 'bitwise xor' arithmetic expression between the two given terms
+func BitwiseXor(left IntegerTerm, right IntegerTerm) ArithmeticExp {
+	return ArithmeticExp{left, right, bitwiseXor, "bitwiseXor"}
+}
+
+// Returns a 'left shift' arithmetic expression between the two given terms
+func LeftShift(left IntegerTerm, right IntegerTerm) ArithmeticExp {
+	return ArithmeticExp{left, right, leftShift, "leftShift"}
+}
+
+// Returns a 'right shift' arithmetic expression between the two given terms
+func RightShift(left IntegerTerm, right IntegerTerm) ArithmeticExp {
+	return ArithmeticExp{left, right, rightShift, "rightShift"}
+}
+
+var errDivisionByZero = errors.New("division by zero")
+
+func plus(left int, right int) (int, error) {
+	return left + right, nil
+}
+
+func subtract(left int, right int) (int, error) {
+	return left - right, nil
+}
+
+func multiply(left int, right int) (int, error) {
+	return left * right, nil
+}
+
+func divide(left int, right int) (int, error) {
+	if right == 0 {
+		return 0, errDivisionByZero
+	}
+	return left / right, nil
+}
+
+func modulo(left int, right int) (int, error) {
+	if right == 0 {
+		return 0, errDivisionByZero
+	}
+	return left % right, nil
+}
+
+func power(left int, right int) (int, error) {
+	if right < 0 {
+		return 0, fmt.Errorf("negative exponent %d", right)
+	}
+
+	// exponentiation by squaring
+	result := 1
+	for right > 0 {
+		if right&1 == 1 {
+			result *= left
+		}
+		left *= left
+		right >>= 1
+	}
+	return result, nil
+}
+
+func bitwiseAnd(left int, right int) (int, error) {
+	return left & right, nil
+}
+
+func bitwiseOr(left int, right int) (int, error) {
+	return left | right, nil
+}
+
+func bitwiseXor(left int, right int) (int, error) {
+	return left ^ right, nil
+}
+
+func leftShift(left int, right int) (int, error) {
+	if right < 0 {
+		return 0, fmt.Errorf("negative shift count %d", right)
+	}
+	return left << uint(right), nil
+}
+
+func rightShift(left int, right int) (int, error) {
+	if right < 0 {
+		return 0, fmt.Errorf("negative shift count %d", right)
+	}
+	return left >> uint(right), nil
+}
+
+// Type representing a unary arithmetic expression, which applies an operator to a single integer term.
+// Since this produces an int result, a UnaryExp is also an integer term.
+type UnaryExp struct {
+	term         IntegerTerm
+	operator     func(term int) int
+	operatorName string
 }
 
-func subtract(left int, right int) int {
-	return left - right
+// Returns the negation of the given term - unary minus. The negation of a number is just a negative number.
+func Negate(term IntegerTerm) IntegerTerm {
+	if n, ok := term.(*number); ok {
+		return &number{-n.int}
+	}
+	return UnaryExp{term, negate, "negate"}
+}
+
+// Returns the bitwise complement of the given term
+func BitwiseNot(term IntegerTerm) IntegerTerm {
+	return UnaryExp{term, bitwiseNot, "bitwiseNot"}
+}
+
+func (u UnaryExp) Eval(state State) (int, error) {
+	v, err := u.term.Eval(state)
+	if err != nil {
+		return 0, err
+	}
+	return u.operator(v), nil
 }
 
-func multiply(left int, right int) int {
-	return left * right
+func (u UnaryExp) Substitute(s Substitution) IntegerTerm {
+	return UnaryExp{u.term.Substitute(s), u.operator, u.operatorName}
+}
+
+func (u UnaryExp) String() string {
+	return fmt.Sprintf("%s{%v}", u.operatorName, u.term)
+}
+
+func negate(term int) int {
+	return -term
+}
+
+func bitwiseNot(term int) int {
+	return ^term
+}
+
+// Type representing a conditional expression - if condition then a else b.
+// Only the branch chosen by the condition is evaluated.
+type ConditionalExp struct {
+	condition BooleanTerm
+	then      IntegerTerm
+	otherwise IntegerTerm
+}
+
+// Returns a conditional expression, which evaluates to then if the condition is true, and otherwise if not
+func Conditional(condition BooleanTerm, then IntegerTerm, otherwise IntegerTerm) ConditionalExp {
+	return ConditionalExp{condition, then, otherwise}
+}
+
+func (c ConditionalExp) Eval(state State) (int, error) {
+	cond, err := c.condition.Eval(state)
+	if err != nil {
+		return 0, err
+	}
+
+	if cond {
+		return c.then.Eval(state)
+	}
+	return c.otherwise.Eval(state)
 }
 
-func divide(left int, right int) int {
-	return left / right
+func (c ConditionalExp) Substitute(s Substitution) IntegerTerm {
+	return ConditionalExp{c.condition.Substitute(s), c.then.Substitute(s), c.otherwise.Substitute(s)}
 }
 
-func modulo(left int, right int) int {
-	return left % right
+func (c ConditionalExp) String() string {
+	return fmt.Sprintf("conditional{%v, %v, %v}", c.condition, c.then, c.otherwise)
 }
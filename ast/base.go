@@ -17,6 +17,7 @@ type State interface {
 // - an ArithmeticExp
 type IntegerTerm interface {
 	Eval(state State) (int, error)
+	Substitute(s Substitution) IntegerTerm
 }
 
 // Type representing a boolean term.
@@ -25,6 +26,7 @@ type IntegerTerm interface {
 // - a boolean expression - BooleanOr, BooleanAnd, BooleanNot
 type BooleanTerm interface {
 	Eval(state State) (bool, error)
+	Substitute(s Substitution) BooleanTerm
 }
 
 // Creates an identifier
@@ -47,6 +49,13 @@ func (ident Identifier) Eval(state State) (int, error) {
 	return state.GetVar(ident)
 }
 
+func (ident Identifier) Substitute(s Substitution) IntegerTerm {
+	if term, ok := s[ident]; ok {
+		return term
+	}
+	return ident
+}
+
 func (ident Identifier) String() string {
 	return fmt.Sprintf("ident(%s)", ident.name)
 }
@@ -65,6 +74,10 @@ func (number number) Eval(_ State) (int, error) {
 	return number.int, nil
 }
 
+func (number number) Substitute(_ Substitution) IntegerTerm {
+	return &number
+}
+
 func (number number) String() string {
 	return fmt.Sprintf("number(%v)", number.int)
 }
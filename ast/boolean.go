@@ -56,6 +56,10 @@ func (b booleanOr) Eval(state State) (bool, error) {
 	return l || r, nil
 }
 
+func (b booleanOr) Substitute(s Substitution) BooleanTerm {
+	return &booleanOr{b.left.Substitute(s), b.right.Substitute(s)}
+}
+
 func (b booleanOr) String() string {
 	return fmt.Sprintf("boolOr{%v, %v}", b.left, b.right)
 }
@@ -74,6 +78,10 @@ func (b booleanAnd) Eval(state State) (bool, error) {
 	return l && r, nil
 }
 
+func (b booleanAnd) Substitute(s Substitution) BooleanTerm {
+	return &booleanAnd{b.left.Substitute(s), b.right.Substitute(s)}
+}
+
 func (b booleanAnd) String() string {
 	return fmt.Sprintf("boolAnd{%v, %v}", b.left, b.right)
 }
@@ -87,6 +95,10 @@ func (b booleanNot) Eval(state State) (bool, error) {
 	return !exp, nil
 }
 
+func (b booleanNot) Substitute(s Substitution) BooleanTerm {
+	return &booleanNot{b.exp.Substitute(s)}
+}
+
 func (b booleanNot) String() string {
 	return fmt.Sprintf("boolNot{%v}", b.exp)
 }
@@ -95,6 +107,10 @@ func (b booleanConst) Eval(_ State) (bool, error) {
 	return b.val, nil
 }
 
+func (b booleanConst) Substitute(_ Substitution) BooleanTerm {
+	return &b
+}
+
 func (b booleanConst) String() string {
 	if b.val {
 		return "boolTrue"
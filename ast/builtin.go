@@ -0,0 +1,130 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// A built-in function, which can be called from an arithmetic expression.
+type Builtin struct {
+	Name  string
+	Arity int
+	fn    func(args []int) (int, error)
+}
+
+// The registry of built-in functions, keyed by name
+var builtins = map[string]*Builtin{}
+
+// Registers a new built-in function with the given name and number of arguments.
+// Any existing built-in with the same name is replaced.
+func RegisterBuiltin(name string, arity int, fn func(args []int) (int, error)) {
+	builtins[name] = &Builtin{name, arity, fn}
+}
+
+// Looks up the built-in function with the given name
+func LookupBuiltin(name string) (*Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// Type representing a call to a built-in function.
+// Since this produces an int result, a BuiltinCall is also an integer term.
+type BuiltinCall struct {
+	Function  *Builtin
+	Arguments []IntegerTerm
+}
+
+// Returns a call to the given built-in function with the given arguments
+func CallBuiltin(function *Builtin, args []IntegerTerm) BuiltinCall {
+	return BuiltinCall{function, args}
+}
+
+func (call BuiltinCall) Eval(state State) (int, error) {
+	args := make([]int, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		val, err := arg.Eval(state)
+		if err != nil {
+			return 0, err
+		}
+		args[i] = val
+	}
+
+	result, err := call.Function.fn(args)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error calling %s", call.Function.Name)
+	}
+	return result, nil
+}
+
+func (call BuiltinCall) Substitute(s Substitution) IntegerTerm {
+	args := make([]IntegerTerm, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		args[i] = arg.Substitute(s)
+	}
+	return BuiltinCall{call.Function, args}
+}
+
+func (call BuiltinCall) String() string {
+	return fmt.Sprintf("call{%s, %v}", call.Function.Name, call.Arguments)
+}
+
+func init() {
+	RegisterBuiltin("abs", 1, func(args []int) (int, error) {
+		if args[0] < 0 {
+			return -args[0], nil
+		}
+		return args[0], nil
+	})
+	RegisterBuiltin("sign", 1, func(args []int) (int, error) {
+		switch {
+		case args[0] < 0:
+			return -1, nil
+		case args[0] > 0:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	})
+	RegisterBuiltin("min", 2, func(args []int) (int, error) {
+		if args[1] < args[0] {
+			return args[1], nil
+		}
+		return args[0], nil
+	})
+	RegisterBuiltin("max", 2, func(args []int) (int, error) {
+		if args[1] > args[0] {
+			return args[1], nil
+		}
+		return args[0], nil
+	})
+	RegisterBuiltin("pow", 2, func(args []int) (int, error) {
+		return power(args[0], args[1])
+	})
+	RegisterBuiltin("gcd", 2, func(args []int) (int, error) {
+		a, b := args[0], args[1]
+		for b != 0 {
+			a, b = b, a%b
+		}
+		if a < 0 {
+			return -a, nil
+		}
+		return a, nil
+	})
+	RegisterBuiltin("sqrt", 1, func(args []int) (int, error) {
+		if args[0] < 0 {
+			return 0, errors.Errorf("square root of negative number %d", args[0])
+		}
+
+		// the float result may be off by one for large ints, so correct it to the integer square root
+		root := int(math.Sqrt(float64(args[0])))
+		for root*root > args[0] {
+			root--
+		}
+		// compare by division, since (root+1)*(root+1) overflows near MaxInt64
+		for root+1 <= args[0]/(root+1) {
+			root++
+		}
+		return root, nil
+	})
+}
@@ -26,6 +26,10 @@ func (c Comparison) Eval(state State) (bool, error) {
 	return c.operator(l, r), nil
 }
 
+func (c Comparison) Substitute(s Substitution) BooleanTerm {
+	return &Comparison{c.left.Substitute(s), c.right.Substitute(s), c.operator, c.operatorName}
+}
+
 func (c Comparison) String() string {
 	return fmt.Sprintf("%s{%v, %v}", c.operatorName, c.left, c.right)
 }
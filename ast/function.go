@@ -0,0 +1,118 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The maximum depth of nested calls to user-defined functions, which limits recursion
+const MaxCallDepth = 1000
+
+// A user-defined function, which can be called from an arithmetic expression.
+// Functions are pure - the body can only refer to the parameters of the function.
+type FunctionDefinition struct {
+	Identifier Identifier
+	Parameters []Identifier
+	Body       IntegerTerm
+}
+
+// A state which can also look up user-defined functions.
+// Functions are looked up when they are called, so a function can call itself (or another function defined later).
+type FunctionState interface {
+	State
+	GetFunction(ident Identifier) (*FunctionDefinition, error)
+}
+
+// Type representing a call to a user-defined function.
+// Since this produces an int result, a FunctionCall is also an integer term.
+type FunctionCall struct {
+	Identifier Identifier
+	Arguments  []IntegerTerm
+
+	// The name as it was written, if the call was made within a module. It is looked up if the module doesn't define
+	// the function, in the same way as the fallback of a ReactionReference. Empty otherwise.
+	Fallback Identifier
+}
+
+// The state used to evaluate the body of a function, which binds the parameters to the arguments
+type callState struct {
+	vars      map[Identifier]int
+	functions FunctionState
+	depth     int
+}
+
+func (s *callState) GetVar(ident Identifier) (int, error) {
+	v, ok := s.vars[ident]
+	if !ok {
+		return 0, fmt.Errorf("no value for identifier %v", ident)
+	}
+	return v, nil
+}
+
+func (s *callState) GetFunction(ident Identifier) (*FunctionDefinition, error) {
+	return s.functions.GetFunction(ident)
+}
+
+func (call FunctionCall) Eval(state State) (int, error) {
+	functions, ok := state.(FunctionState)
+	if !ok {
+		return 0, fmt.Errorf("undefined function %s", call.Identifier.Name())
+	}
+
+	def, err := functions.GetFunction(call.Identifier)
+	if err != nil && call.Fallback.Name() != "" {
+		if fallback, fallbackErr := functions.GetFunction(call.Fallback); fallbackErr == nil {
+			def, err = fallback, nil
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(call.Arguments) != len(def.Parameters) {
+		return 0, fmt.Errorf("%s expects %d argument(s) but got %d", call.Identifier.Name(), len(def.Parameters), len(call.Arguments))
+	}
+
+	depth := 1
+	if caller, ok := state.(*callState); ok {
+		depth = caller.depth + 1
+	}
+	if depth > MaxCallDepth {
+		return 0, fmt.Errorf("maximum function call depth (%d) exceeded in %s", MaxCallDepth, call.Identifier.Name())
+	}
+
+	vars := make(map[Identifier]int, len(def.Parameters))
+	for i, arg := range call.Arguments {
+		val, err := arg.Eval(state)
+		if err != nil {
+			return 0, err
+		}
+		vars[def.Parameters[i]] = val
+	}
+
+	return def.Body.Eval(&callState{vars, functions, depth})
+}
+
+func (call FunctionCall) Substitute(s Substitution) IntegerTerm {
+	args := make([]IntegerTerm, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		args[i] = arg.Substitute(s)
+	}
+	return FunctionCall{call.Identifier, args, call.Fallback}
+}
+
+func (call FunctionCall) String() string {
+	return fmt.Sprintf("call{%s, %v}", call.Identifier.Name(), call.Arguments)
+}
+
+func (def FunctionDefinition) String() string {
+	return fmt.Sprintf("functionDef{%v, %v, %v}", def.Identifier, def.Parameters, def.Body)
+}
+
+// Returns the signature of the function, e.g. mid(a, b)
+func (def FunctionDefinition) Signature() string {
+	params := make([]string, len(def.Parameters))
+	for i, param := range def.Parameters {
+		params[i] = param.Name()
+	}
+	return fmt.Sprintf("%s(%s)", def.Identifier.Name(), strings.Join(params, ", "))
+}
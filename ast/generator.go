@@ -0,0 +1,59 @@
+package ast
+
+import "fmt"
+
+// The maximum number of molecules a solution literal can contain. This stops a large repetition or range from
+// overflowing the cardinality of the solution, or exhausting memory when the solution is evaluated.
+const MaxCardinality = 1 << 24
+
+// A generator of int tuples in a solution literal, such as a range of ints.
+// Generators are expanded directly into the multiplicities of a solution when the program is evaluated,
+// rather than first being materialised as a slice of tuples.
+type Generator interface {
+	// Calls the add function once for each distinct tuple, along with the number of times it occurs
+	Generate(add func(tuple IntTuple, count int))
+}
+
+// A range of ints from Start to End (inclusive), increasing by Step. Each int in the range occurs Count times.
+type Range struct {
+	Start int
+	End   int
+	Step  int
+	Count int
+}
+
+// A single int tuple which occurs Count times.
+type Repetition struct {
+	Tuple IntTuple
+	Count int
+}
+
+func (r *Range) Generate(add func(tuple IntTuple, count int)) {
+	if r.Count == 0 || r.Start > r.End {
+		return
+	}
+	for i := r.Start; ; i += r.Step {
+		add(IntTuple{Shape: 1, Values: [16]int{i}}, r.Count)
+
+		// stop before the next int would pass the end, which could overflow if the range ends near the largest int.
+		// The distance to the end is compared as an unsigned int, as it can be larger than the largest int.
+		if uint(r.End-i) < uint(r.Step) {
+			break
+		}
+	}
+}
+
+func (r *Repetition) Generate(add func(tuple IntTuple, count int)) {
+	if r.Count == 0 {
+		return
+	}
+	add(r.Tuple, r.Count)
+}
+
+func (r Range) String() string {
+	return fmt.Sprintf("range{%d, %d, %d, %d}", r.Start, r.End, r.Step, r.Count)
+}
+
+func (r Repetition) String() string {
+	return fmt.Sprintf("repetition{%v, %d}", r.Tuple, r.Count)
+}
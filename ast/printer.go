@@ -0,0 +1,509 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// printer.go converts the AST back into canonical cham source code, which parses again to give the same AST.
+//
+// Brackets are only placed around an operand when the precedence of the operators requires them. The precedence levels
+// are the same as those used by the parser (see parser/expression.go), from loosest to tightest.
+
+// Precedence levels of the operators
+const (
+	precedenceOr = iota + 1
+	precedenceAnd
+	precedenceComparison
+	precedenceBitwiseOr
+	precedenceBitwiseXor
+	precedenceBitwiseAnd
+	precedenceShift
+	precedenceAdd
+	precedenceMultiply
+	precedenceUnary
+	precedencePower
+
+	// The precedence of an operand which never needs brackets, such as an identifier
+	precedenceAtom
+)
+
+// An operator as it is written in source code
+type operatorSyntax struct {
+	symbol     string
+	precedence int
+}
+
+// The syntax of the arithmetic, unary and comparison operators, keyed by the name of the operator
+var operators = map[string]operatorSyntax{
+	"plus":             {"+", precedenceAdd},
+	"subtract":         {"-", precedenceAdd},
+	"multiply":         {"*", precedenceMultiply},
+	"divide":           {"/", precedenceMultiply},
+	"modulo":           {"%", precedenceMultiply},
+	"power":            {"**", precedencePower},
+	"bitwiseAnd":       {"&", precedenceBitwiseAnd},
+	"bitwiseOr":        {"|", precedenceBitwiseOr},
+	"bitwiseXor":       {"^", precedenceBitwiseXor},
+	"leftShift":        {"<<", precedenceShift},
+	"rightShift":       {">>", precedenceShift},
+	"negate":           {"-", precedenceUnary},
+	"bitwiseNot":       {"~", precedenceUnary},
+	"equals":           {"==", precedenceComparison},
+	"notEquals":        {"!=", precedenceComparison},
+	"lessThan":         {"<", precedenceComparison},
+	"greaterThan":      {">", precedenceComparison},
+	"lessThanEqual":    {"<=", precedenceComparison},
+	"greaterThanEqual": {">=", precedenceComparison},
+}
+
+// Returns the source code of a node of the AST - a definition, program, solution, stage, pattern, product or
+// expression. Panics if the node can't be printed.
+func Source(node interface{}) string {
+	switch node := node.(type) {
+	case Definition:
+		return definitionSource(node)
+	case *Program:
+		return programSource(node)
+	case *Solution:
+		return solutionSource(node)
+	case Stage:
+		return stageSource(node)
+	case Pattern:
+		return patternSource(node)
+	case Product:
+		return productSource(node)
+	case IntegerTerm:
+		return integerSource(node)
+	case BooleanTerm:
+		return booleanSource(node)
+	default:
+		panic(fmt.Sprintf("cannot print %T as source code", node))
+	}
+}
+
+// Returns the source code of a definition statement
+func definitionSource(def Definition) string {
+	switch def := def.(type) {
+	case *ReactionPointer:
+		return fmt.Sprintf("%s%s: %s", def.Identifier.Name(), parametersSource(def.Parameters), stagesSource(def.Reactions))
+	case *FunctionDefinition:
+		return fmt.Sprintf("fn %s%s = %s", def.Identifier.Name(), parametersSource(def.Parameters), integerSource(def.Body))
+	case *Import:
+		return fmt.Sprintf("import %s as %s", strconv.Quote(def.Path), def.Namespace)
+	default:
+		panic(fmt.Sprintf("cannot print %T as source code", def))
+	}
+}
+
+// Returns the source code of the parameters of a definition, e.g. (a, b), or nothing if there are none
+func parametersSource(params []Identifier) string {
+	if len(params) == 0 {
+		return ""
+	}
+	names := make([]string, len(params))
+	for i, param := range params {
+		names[i] = param.Name()
+	}
+	return fmt.Sprintf("(%s)", strings.Join(names, ", "))
+}
+
+// Returns the source code of a program, including its name if it has one
+func programSource(program *Program) string {
+	s := solutionSource(program.Input)
+	if len(program.Reactions) > 0 {
+		s += " | " + stagesSource(program.Reactions)
+	}
+	if program.Name != nil {
+		s = program.Name.Name() + " = " + s
+	}
+	return s
+}
+
+// Returns the source code of a solution literal, enclosed in curly brackets
+func solutionSource(solution *Solution) string {
+	var molecules []string
+	for _, tuple := range solution.Tuples {
+		molecules = append(molecules, tuple.Source())
+	}
+	for _, generator := range solution.Generators {
+		molecules = append(molecules, generatorSource(generator))
+	}
+	for _, subsolution := range solution.Subsolutions {
+		molecules = append(molecules, solutionSource(subsolution))
+	}
+	for _, reaction := range solution.Reactions {
+		molecules = append(molecules, ReactionMoleculeSource(reaction))
+	}
+	for _, ref := range solution.References {
+		if ref.Name() == "_" {
+			molecules = append(molecules, "_")
+		} else {
+			molecules = append(molecules, "$"+ref.Name())
+		}
+	}
+	return fmt.Sprintf("{%s}", strings.Join(molecules, ", "))
+}
+
+// Returns the source code of the tuple, as it would be written in a solution literal
+func (tuple IntTuple) Source() string {
+	values := make([]string, tuple.Shape)
+	for i, v := range tuple.Slice() {
+		values[i] = strconv.Itoa(v)
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return fmt.Sprintf("[%s]", strings.Join(values, ", "))
+}
+
+// Returns the source code of a generator in a solution literal
+func generatorSource(generator Generator) string {
+	switch g := generator.(type) {
+	case *Range:
+		s := fmt.Sprintf("%d..%d", g.Start, g.End)
+		if g.Step != 1 {
+			s += fmt.Sprintf(" step %d", g.Step)
+		}
+		if g.Count != 1 {
+			s += fmt.Sprintf(" ^ %d", g.Count)
+		}
+		return s
+	case *Repetition:
+		return fmt.Sprintf("%s ^ %d", g.Tuple.Source(), g.Count)
+	default:
+		panic(fmt.Sprintf("cannot print %T as source code", generator))
+	}
+}
+
+// Returns the source code of a chain of stages, separated by the reaction chain operator
+func stagesSource(stages []Stage) string {
+	res := make([]string, len(stages))
+	for i, stage := range stages {
+		res[i] = stageSource(stage)
+	}
+	return strings.Join(res, " | ")
+}
+
+// Returns the source code of a single stage of a reaction chain
+func stageSource(stage Stage) string {
+	switch stage := stage.(type) {
+	case *Reaction:
+		return reactionSource(stage)
+	case *ReactionGroup:
+		return groupSource(stage)
+	case *ReactionReference:
+		return referenceSource(stage)
+	case *Loop:
+		s := fmt.Sprintf("(%s)*", stagesSource(stage.Stages))
+		if stage.Limit > 0 {
+			s += strconv.Itoa(stage.Limit)
+		}
+		return s
+	case *Branch:
+		s := "split"
+		if stage.Predicate != nil {
+			s += fmt.Sprintf("(%s)", booleanSource(stage.Predicate))
+		}
+		for _, branch := range stage.Branches {
+			if len(branch) == 0 {
+				s += " {}"
+			} else {
+				s += fmt.Sprintf(" { %s }", stagesSource(branch))
+			}
+		}
+		return s
+	default:
+		panic(fmt.Sprintf("cannot print %T as source code", stage))
+	}
+}
+
+// Returns the source code of a group of reactions composed in parallel, followed by its fallback groups
+func groupSource(group *ReactionGroup) string {
+	var members []string
+	for i := 0; i < len(group.Reactions); i++ {
+		// a reversible rule is parsed into a heating rule followed by the opposite cooling rule
+		if i+1 < len(group.Reactions) && isReversible(group.Reactions[i], group.Reactions[i+1]) {
+			members = append(members, reversibleSource(group.Reactions[i]))
+			i++
+			continue
+		}
+		members = append(members, reactionSource(group.Reactions[i]))
+	}
+	for _, ref := range group.References {
+		members = append(members, referenceSource(ref))
+	}
+
+	s := strings.Join(members, " + ")
+	if group.Fallback != nil {
+		s += " > " + groupSource(group.Fallback)
+	}
+	return s
+}
+
+// Tests whether a heating rule and a cooling rule are the two directions of a reversible rule (<~>)
+func isReversible(heating *Reaction, cooling *Reaction) bool {
+	if heating.Kind != HeatingRule || cooling.Kind != CoolingRule {
+		return false
+	}
+	if len(heating.Alternatives) > 0 || len(heating.Locals) > 0 || len(cooling.Alternatives) > 0 || len(cooling.Locals) > 0 {
+		return false
+	}
+	return patternsSource(heating.Input.Patterns) == productsSource(cooling.Action.Products) &&
+		patternsSource(cooling.Input.Patterns) == productsSource(heating.Action.Products) &&
+		conditionSource(heating.Condition) == conditionSource(cooling.Condition)
+}
+
+// Returns the source code of a reversible rule, given its heating rule
+func reversibleSource(heating *Reaction) string {
+	return fmt.Sprintf("%s <~> %s%s", patternsSource(heating.Input.Patterns), productsSource(heating.Action.Products),
+		conditionSource(heating.Condition))
+}
+
+// Returns the source code of a reference to a defined reaction, e.g. :max or :sum(2)
+func referenceSource(ref *ReactionReference) string {
+	if len(ref.Arguments) == 0 {
+		return ":" + ref.Identifier.Name()
+	}
+	return fmt.Sprintf(":%s(%s)", ref.Identifier.Name(), argumentsSource(ref.Arguments))
+}
+
+// Returns the source code of a reaction molecule, which is a reaction enclosed in brackets
+func ReactionMoleculeSource(reaction *Reaction) string {
+	if reaction.Once {
+		return fmt.Sprintf("(once %s)", reactionSource(reaction))
+	}
+	return fmt.Sprintf("(%s)", reactionSource(reaction))
+}
+
+// Returns the source code of a reaction or structural rule
+func reactionSource(reaction *Reaction) string {
+	var s string
+	switch reaction.Kind {
+	case HeatingRule:
+		s = fmt.Sprintf("%s ~> %s", patternsSource(reaction.Input.Patterns), actionSource(reaction.Action))
+	case CoolingRule:
+		// the cooled molecules are written on the left, and the heated molecules (the input) on the right
+		s = fmt.Sprintf("%s <~ %s", productsSource(reaction.Action.Products), patternsSource(reaction.Input.Patterns))
+	default:
+		s = fmt.Sprintf("%s => %s", patternsSource(reaction.Input.Patterns), actionSource(reaction.Action))
+	}
+	s += conditionSource(reaction.Condition)
+
+	for _, alt := range reaction.Alternatives {
+		s += " else " + actionSource(alt.Action) + conditionSource(alt.Condition)
+	}
+
+	if len(reaction.Locals) > 0 {
+		locals := make([]string, len(reaction.Locals))
+		for i, local := range reaction.Locals {
+			locals[i] = fmt.Sprintf("%s = %s", local.Identifier.Name(), integerSource(local.Value))
+		}
+		s += " where " + strings.Join(locals, ", ")
+	}
+	return s
+}
+
+// Returns the source code of a reaction condition, including the 'if', or nothing if there is no condition
+func conditionSource(condition *ReactionCondition) string {
+	if condition == nil {
+		return ""
+	}
+	if c, ok := condition.Expression.(*booleanConst); ok && c.val {
+		return ""
+	}
+	return " if " + booleanSource(condition.Expression)
+}
+
+// Returns the source code of a reaction action.
+// The products are enclosed in curly brackets if there are none, or if the first product is a subsolution (as the
+// bracket would otherwise be taken to enclose the products).
+func actionSource(action *ReactionAction) string {
+	if len(action.Products) == 0 {
+		return "{}"
+	}
+
+	first := action.Products[0]
+	if airlock, ok := first.(*AirlockProduct); ok {
+		first = airlock.Product
+	}
+	if _, ok := first.(*SolutionProduct); ok {
+		return fmt.Sprintf("{%s}", productsSource(action.Products))
+	}
+	return productsSource(action.Products)
+}
+
+// Returns the source code of patterns separated by commas
+func patternsSource(patterns []Pattern) string {
+	res := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		res[i] = patternSource(pattern)
+	}
+	return strings.Join(res, ", ")
+}
+
+// Returns the source code of a pattern in a reaction input
+func patternSource(pattern Pattern) string {
+	switch pattern := pattern.(type) {
+	case IdentifierTuple:
+		names := make([]string, len(pattern.Values))
+		for i, ident := range pattern.Values {
+			names[i] = ident.Name()
+		}
+		if len(names) == 1 {
+			return names[0]
+		}
+		return fmt.Sprintf("[%s]", strings.Join(names, ", "))
+	case *SolutionPattern:
+		return fmt.Sprintf("{%s}", patternsSource(pattern.Patterns))
+	case *AirlockPattern:
+		return fmt.Sprintf("%s <| %s", patternSource(pattern.Pattern), pattern.Solution.Name())
+	case *ReactionPattern:
+		return fmt.Sprintf("(%s)", pattern.Identifier.Name())
+	default:
+		panic(fmt.Sprintf("cannot print %T as source code", pattern))
+	}
+}
+
+// Returns the source code of products separated by commas
+func productsSource(products []Product) string {
+	res := make([]string, len(products))
+	for i, product := range products {
+		res[i] = productSource(product)
+	}
+	return strings.Join(res, ", ")
+}
+
+// Returns the source code of a product in a reaction action
+func productSource(product Product) string {
+	switch product := product.(type) {
+	case IntegerTermTuple:
+		if len(product.Values) == 1 {
+			return integerSource(product.Values[0])
+		}
+		return fmt.Sprintf("[%s]", argumentsSource(product.Values))
+	case *SolutionProduct:
+		return fmt.Sprintf("{%s}", productsSource(product.Products))
+	case *AirlockProduct:
+		return fmt.Sprintf("%s <| %s", productSource(product.Product), product.Solution.Name())
+	case *Reaction:
+		return ReactionMoleculeSource(product)
+	default:
+		panic(fmt.Sprintf("cannot print %T as source code", product))
+	}
+}
+
+// Returns the source code of integer terms separated by commas
+func argumentsSource(args []IntegerTerm) string {
+	res := make([]string, len(args))
+	for i, arg := range args {
+		res[i] = integerSource(arg)
+	}
+	return strings.Join(res, ", ")
+}
+
+// Returns the source code of an arithmetic expression
+func integerSource(term IntegerTerm) string {
+	switch term := term.(type) {
+	case Identifier:
+		return term.Name()
+	case *number:
+		return strconv.Itoa(term.int)
+	case number:
+		return strconv.Itoa(term.int)
+	case ArithmeticExp:
+		op := operators[term.operatorName]
+		left, right := integerPrecedence(term.left), integerPrecedence(term.right)
+
+		// ** is right associative, and its right operand can have a unary operator
+		leftBrackets, rightBrackets := left < op.precedence, right <= op.precedence
+		if op.precedence == precedencePower {
+			leftBrackets, rightBrackets = left <= op.precedence, right < precedenceUnary
+		}
+		return fmt.Sprintf("%s %s %s", bracket(integerSource(term.left), leftBrackets), op.symbol,
+			bracket(integerSource(term.right), rightBrackets))
+	case UnaryExp:
+		symbol, operand := operators[term.operatorName].symbol, bracket(integerSource(term.term), integerPrecedence(term.term) < precedenceUnary)
+		if symbol == "-" && strings.HasPrefix(operand, "-") {
+			// - -x rather than --x
+			symbol += " "
+		}
+		return symbol + operand
+	case ConditionalExp:
+		return fmt.Sprintf("if %s then %s else %s", booleanSource(term.condition), integerSource(term.then), integerSource(term.otherwise))
+	case FunctionCall:
+		return fmt.Sprintf("%s(%s)", term.Identifier.Name(), argumentsSource(term.Arguments))
+	case BuiltinCall:
+		return fmt.Sprintf("%s(%s)", term.Function.Name, argumentsSource(term.Arguments))
+	default:
+		panic(fmt.Sprintf("cannot print %T as source code", term))
+	}
+}
+
+// Returns the precedence of the operator of an arithmetic expression.
+// A negative number is written with a unary minus, and a conditional expression takes everything after 'else', so it
+// always needs brackets when it is an operand.
+func integerPrecedence(term IntegerTerm) int {
+	switch term := term.(type) {
+	case ArithmeticExp:
+		return operators[term.operatorName].precedence
+	case UnaryExp:
+		return precedenceUnary
+	case ConditionalExp:
+		return 0
+	case *number:
+		if term.int < 0 {
+			return precedenceUnary
+		}
+	case number:
+		if term.int < 0 {
+			return precedenceUnary
+		}
+	}
+	return precedenceAtom
+}
+
+// Returns the source code of a boolean expression
+func booleanSource(term BooleanTerm) string {
+	switch term := term.(type) {
+	case *Comparison:
+		return fmt.Sprintf("%s %s %s", integerSource(term.left), operators[term.operatorName].symbol, integerSource(term.right))
+	case *booleanOr:
+		return fmt.Sprintf("%s || %s", booleanSource(term.left),
+			bracket(booleanSource(term.right), booleanPrecedence(term.right) <= precedenceOr))
+	case *booleanAnd:
+		return fmt.Sprintf("%s && %s", bracket(booleanSource(term.left), booleanPrecedence(term.left) < precedenceAnd),
+			bracket(booleanSource(term.right), booleanPrecedence(term.right) <= precedenceAnd))
+	case *booleanNot:
+		// ! applies to a comparison, so !x > 1 is the same as !(x > 1)
+		return "!" + bracket(booleanSource(term.exp), booleanPrecedence(term.exp) < precedenceComparison)
+	case *booleanConst:
+		// there is no boolean literal, so a comparison which always has the same result is used instead
+		if term.val {
+			return "0 == 0"
+		}
+		return "0 != 0"
+	default:
+		panic(fmt.Sprintf("cannot print %T as source code", term))
+	}
+}
+
+// Returns the precedence of the operator of a boolean expression
+func booleanPrecedence(term BooleanTerm) int {
+	switch term.(type) {
+	case *booleanOr:
+		return precedenceOr
+	case *booleanAnd:
+		return precedenceAnd
+	}
+	return precedenceComparison
+}
+
+// Encloses the source code of an operand in brackets, if they are needed
+func bracket(src string, needed bool) string {
+	if needed {
+		return "(" + src + ")"
+	}
+	return src
+}
@@ -4,11 +4,34 @@ import (
 	"fmt"
 )
 
-// A program is made up of input in the form of an array of int tuples,
-// and a sequence of reaction rules to apply in order.
+// A program is made up of input in the form of a solution,
+// and a chain of reaction stages to apply in order.
 type Program struct {
-	Input     []IntTuple
-	Reactions []*Reaction
+	Input     *Solution
+	Reactions []Stage
+
+	// The name that the result of the program is stored as, or nil if it is not stored
+	Name *Identifier
+}
+
+// A definition which can be stored for later use - either a reaction definition or a function definition.
+// An import statement is also a definition, as it defines the contents of another file in a namespace.
+type Definition interface {
+	definition()
+}
+
+func (*ReactionPointer) definition()    {}
+func (*FunctionDefinition) definition() {}
+func (*Import) definition()             {}
+
+// An import of the definitions in another file, which are defined with the namespace as a prefix (e.g. sort.max)
+type Import struct {
+	Path      string
+	Namespace string
+}
+
+func (imp Import) String() string {
+	return fmt.Sprintf("import{%q, %s}", imp.Path, imp.Namespace)
 }
 
 func (program Program) String() string {
@@ -4,29 +4,157 @@ import (
 	"fmt"
 )
 
-// AST encapsulating a defined reaction
+// Interface representing a single stage of a reaction chain.
+// Each stage is applied to the solution until it becomes stable, before the next stage begins.
+// Could be:
+// - a Reaction
+// - a ReactionGroup
+// - a ReactionReference
+// - a Loop
+// - a Branch
+type Stage interface {
+	stage()
+}
+
+// AST encapsulating a defined reaction.
+// The parameters are substituted into the reactions when the definition is used.
 type ReactionPointer struct {
 	Identifier Identifier
-	Reactions  []*Reaction
+	Parameters []Identifier
+	Reactions  []Stage
+}
+
+// AST encapsulating a reference to a defined reaction, along with the arguments for its parameters.
+// References are resolved when the program is evaluated, so they always refer to the latest definition.
+type ReactionReference struct {
+	Identifier Identifier
+	Arguments  []IntegerTerm
+
+	// The name as it was written, if the reference was made within a module (so the identifier is qualified by the
+	// namespace of the module). This is looked up if the module doesn't define the identifier, so a module can refer to
+	// the standard library and to definitions outside of it. Empty otherwise.
+	Fallback Identifier
 }
 
-// AST encapsulating a single reaction
+// AST encapsulating a loop: a chain of stages which is repeated until an iteration takes place without any
+// reactions (the solution has stopped changing), or the maximum number of iterations is reached.
+type Loop struct {
+	Stages []Stage
+
+	// The maximum number of iterations, or 0 if there is no limit
+	Limit int
+}
+
+// AST encapsulating a split of the solution into branches, each of which is evaluated by its own chain of stages.
+// The solutions of the branches are merged back together (by union) afterwards.
+//
+// If there is a predicate, there are two branches: the first receives the molecules which satisfy the predicate,
+// and the second receives the rest. Otherwise, each branch receives a copy of the whole solution.
+type Branch struct {
+	// The predicate used to split the solution, which can be nil.
+	// Every identifier in the predicate refers to the molecule being tested.
+	Predicate BooleanTerm
+	Branches  [][]Stage
+}
+
+// AST encapsulating a single reaction.
+// A reaction can also be a molecule within a solution (a reaction molecule), in which case it
+// takes place whenever its reactants are present.
 type Reaction struct {
+	Kind      ReactionKind
 	Input     *ReactionInput
 	Action    *ReactionAction
 	Condition *ReactionCondition
+
+	// Alternative outcomes of the reaction, which are tried in order when the condition is not satisfied
+	Alternatives []*ReactionAlternative
+
+	// Local variables, which are bound after the reactants are matched and before the conditions are tested
+	Locals []*LocalBinding
+
+	// Whether the reaction molecule is consumed when the reaction takes place
+	Once bool
+}
+
+// AST encapsulating an alternative outcome of a reaction, written after 'else'.
+// The alternative takes place if its condition is satisfied, and the conditions before it are not.
+type ReactionAlternative struct {
+	Action    *ReactionAction
+	Condition *ReactionCondition
+}
+
+// AST encapsulating a local variable of a reaction, written after 'where'.
+// The value is evaluated once each time the reaction is attempted, and can refer to the variables bound by the
+// reaction input, and to the local variables before it.
+type LocalBinding struct {
+	Identifier Identifier
+	Value      IntegerTerm
+}
+
+// Represents the kind of a reaction rule.
+// Heating and cooling rules are the structural rules of the chemical abstract machine: heating rules
+// break molecules down so they are able to react, and cooling rules build them back up again afterwards.
+type ReactionKind int
+
+const (
+	// A normal reaction rule (=>)
+	ReactionRule ReactionKind = iota
+	// A structural rule which heats the solution (~>)
+	HeatingRule
+	// A structural rule which cools the solution (<~)
+	CoolingRule
+)
+
+// AST encapsulating a group of reactions composed in parallel.
+// All reactions in the group act upon the same solution, and the group is
+// only stable once none of the reactions are able to take place.
+//
+// A group may have a lower priority fallback group, the reactions of which are
+// only attempted when none of the reactions in this group are able to take place.
+//
+// A group may also contain references to defined reactions, which are added to the
+// group when the references are resolved.
+type ReactionGroup struct {
+	Reactions  []*Reaction
+	References []*ReactionReference
+	Fallback   *ReactionGroup
+}
+
+// Interface representing a pattern in the reaction input, which is matched against a single molecule.
+// Could be:
+// - an IdentifierTuple (matches an int tuple of the same shape)
+// - a SolutionPattern (matches a subsolution)
+// - an AirlockPattern (matches a molecule within a subsolution)
+// - a ReactionPattern (matches a reaction molecule)
+type Pattern interface {
+	pattern()
+}
+
+// Interface representing a product in the reaction action, which creates a single molecule.
+// Could be:
+// - an IntegerTermTuple (creates an int tuple)
+// - a SolutionProduct (creates a subsolution)
+// - an AirlockProduct (adds a molecule to a subsolution)
+// - a Reaction (creates a reaction molecule)
+type Product interface {
+	product()
+}
+
+// A pattern which matches any reaction molecule, binding it to the identifier
+type ReactionPattern struct {
+	Identifier Identifier
 }
 
 // Represents the reaction input
-// Just an array of identifier tuples, can be empty.
+// Just an array of patterns, can be empty.
 type ReactionInput struct {
-	Idents []IdentifierTuple
+	Patterns []Pattern
 }
 
 // Represents the reaction action
-// This is formed of products: an array of int term tuples, which could be empty.
+// This is formed of products: an array of int term tuples or subsolutions, which could be empty.
 type ReactionAction struct {
-	Products []IntegerTermTuple
+	Products []Product
 }
 
 // Represents the reaction condition
@@ -36,8 +164,69 @@ type ReactionCondition struct {
 	Expression BooleanTerm
 }
 
+func (kind ReactionKind) String() string {
+	switch kind {
+	case HeatingRule:
+		return "heating"
+	case CoolingRule:
+		return "cooling"
+	default:
+		return "reaction"
+	}
+}
+
+// Returns whether the rule is a structural (heating or cooling) rule
+func (kind ReactionKind) IsStructural() bool {
+	return kind == HeatingRule || kind == CoolingRule
+}
+
+func (*Reaction) stage()          {}
+func (*ReactionGroup) stage()     {}
+func (*ReactionReference) stage() {}
+func (*Loop) stage()              {}
+func (*Branch) stage()            {}
+
+// Adds a stage to the group, composing it in parallel with the reactions already in the group
+func (group *ReactionGroup) Add(stage Stage) error {
+	switch stage := stage.(type) {
+	case *Reaction:
+		group.Reactions = append(group.Reactions, stage)
+	case *ReactionGroup:
+		if stage.Fallback != nil {
+			return fmt.Errorf("a prioritised group of reactions cannot be composed in parallel")
+		}
+		group.Reactions = append(group.Reactions, stage.Reactions...)
+		group.References = append(group.References, stage.References...)
+	case *ReactionReference:
+		group.References = append(group.References, stage)
+	default:
+		return fmt.Errorf("%v cannot be composed in parallel", stage)
+	}
+	return nil
+}
+
+// Creates a copy of the group, including its chain of fallback groups
+func (group *ReactionGroup) Copy() *ReactionGroup {
+	if group == nil {
+		return nil
+	}
+	return &ReactionGroup{
+		Reactions:  append([]*Reaction{}, group.Reactions...),
+		References: append([]*ReactionReference{}, group.References...),
+		Fallback:   group.Fallback.Copy(),
+	}
+}
+
+func (*Reaction) product()        {}
+func (*ReactionPattern) pattern() {}
+
 func (reaction Reaction) String() string {
-	f := `reaction{
+	kind := reaction.Kind.String()
+	if reaction.Once {
+		kind = "once " + kind
+	}
+
+	f := `%v{
   input{
     %v
   },
@@ -46,7 +235,41 @@ func (reaction Reaction) String() string {
   },
   condition{
     %v
-  },
+  },%v
 }`
-	return fmt.Sprintf(f, reaction.Input.Idents, reaction.Action.Products, reaction.Condition.Expression)
+	alternatives := ""
+	for _, alt := range reaction.Alternatives {
+		alternatives += fmt.Sprintf("\n  else{\n    %v if %v\n  },", alt.Action.Products, alt.Condition.Expression)
+	}
+	for _, local := range reaction.Locals {
+		alternatives += fmt.Sprintf("\n  where{\n    %v = %v\n  },", local.Identifier, local.Value)
+	}
+	return fmt.Sprintf(f, kind, reaction.Input.Patterns, reaction.Action.Products, reaction.Condition.Expression, alternatives)
+}
+
+func (pattern ReactionPattern) String() string {
+	return fmt.Sprintf("reactionPattern{%v}", pattern.Identifier)
+}
+
+func (loop Loop) String() string {
+	return fmt.Sprintf("loop{%v, %v}", loop.Stages, loop.Limit)
+}
+
+func (branch Branch) String() string {
+	return fmt.Sprintf("branch{%v, %v}", branch.Predicate, branch.Branches)
+}
+
+func (ref ReactionReference) String() string {
+	return fmt.Sprintf("reference{%v, %v}", ref.Identifier, ref.Arguments)
+}
+
+func (group ReactionGroup) String() string {
+	s := fmt.Sprintf("group%v", group.Reactions)
+	if len(group.References) > 0 {
+		s = fmt.Sprintf("group%v%v", group.Reactions, group.References)
+	}
+	if group.Fallback != nil {
+		return fmt.Sprintf("%s > %v", s, group.Fallback)
+	}
+	return s
 }
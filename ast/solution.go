@@ -0,0 +1,68 @@
+package ast
+
+import (
+	"fmt"
+)
+
+// A solution literal, as given in the program input.
+// This is a multiset of int tuples, which can also contain nested subsolutions and reaction molecules.
+// Ranges and repeated tuples are kept as generators, which are expanded when the program is evaluated.
+// It can also refer to named solutions, the contents of which are added to the solution when the program is evaluated.
+type Solution struct {
+	Tuples       []IntTuple
+	Generators   []Generator
+	Subsolutions []*Solution
+	Reactions    []*Reaction
+	References   []Identifier
+}
+
+// A pattern which matches a (stable) subsolution.
+// The subsolution must contain exactly one molecule for each of the inner patterns.
+type SolutionPattern struct {
+	Patterns []Pattern
+}
+
+// A product which creates a new subsolution containing each of the inner products.
+type SolutionProduct struct {
+	Products []Product
+}
+
+// A pattern which matches a subsolution containing a molecule that matches the inner pattern.
+// The rest of the subsolution is bound to the solution identifier.
+// This is the 'airlock' of the chemical abstract machine, written as m <| s.
+type AirlockPattern struct {
+	Pattern  Pattern
+	Solution Identifier
+}
+
+// A product which creates a subsolution containing the molecule created by the inner product,
+// along with the contents of the solution bound to the solution identifier.
+type AirlockProduct struct {
+	Product  Product
+	Solution Identifier
+}
+
+func (*SolutionPattern) pattern() {}
+func (*SolutionProduct) product() {}
+func (*AirlockPattern) pattern()  {}
+func (*AirlockProduct) product()  {}
+
+func (solution Solution) String() string {
+	return fmt.Sprintf("solution{%v, %v, %v, %v, %v}", solution.Tuples, solution.Generators, solution.Subsolutions, solution.Reactions, solution.References)
+}
+
+func (pattern SolutionPattern) String() string {
+	return fmt.Sprintf("solutionPattern%v", pattern.Patterns)
+}
+
+func (product SolutionProduct) String() string {
+	return fmt.Sprintf("solutionProduct%v", product.Products)
+}
+
+func (pattern AirlockPattern) String() string {
+	return fmt.Sprintf("airlockPattern{%v, %v}", pattern.Pattern, pattern.Solution)
+}
+
+func (product AirlockProduct) String() string {
+	return fmt.Sprintf("airlockProduct{%v, %v}", product.Product, product.Solution)
+}
@@ -0,0 +1,161 @@
+package ast
+
+// A substitution maps identifiers to the integer terms which replace them.
+// This is used to substitute the arguments of a parameterised reaction definition into its reactions.
+type Substitution map[Identifier]IntegerTerm
+
+// Returns a copy of the substitution without the given identifiers
+func (s Substitution) without(idents []Identifier) Substitution {
+	res := make(Substitution, len(s))
+	for k, v := range s {
+		res[k] = v
+	}
+	for _, ident := range idents {
+		delete(res, ident)
+	}
+	return res
+}
+
+// Substitutes into each of the stages, returning new stages.
+func SubstituteStages(stages []Stage, s Substitution) []Stage {
+	res := make([]Stage, 0, len(stages))
+	for _, stage := range stages {
+		switch stage := stage.(type) {
+		case *Reaction:
+			res = append(res, stage.Substitute(s))
+		case *ReactionGroup:
+			res = append(res, stage.Substitute(s))
+		case *ReactionReference:
+			res = append(res, stage.Substitute(s))
+		case *Loop:
+			res = append(res, &Loop{Stages: SubstituteStages(stage.Stages, s), Limit: stage.Limit})
+		case *Branch:
+			res = append(res, stage.Substitute(s))
+		}
+	}
+	return res
+}
+
+// Substitutes into the predicate and each of the branches, returning a new branch.
+func (branch *Branch) Substitute(s Substitution) *Branch {
+	res := &Branch{Branches: make([][]Stage, 0, len(branch.Branches))}
+	if branch.Predicate != nil {
+		res.Predicate = branch.Predicate.Substitute(s)
+	}
+	for _, stages := range branch.Branches {
+		res.Branches = append(res.Branches, SubstituteStages(stages, s))
+	}
+	return res
+}
+
+// Substitutes into each of the reactions in the group (and its fallback groups), returning a new group.
+func (group *ReactionGroup) Substitute(s Substitution) *ReactionGroup {
+	if group == nil {
+		return nil
+	}
+
+	reactions := make([]*Reaction, 0, len(group.Reactions))
+	for _, reaction := range group.Reactions {
+		reactions = append(reactions, reaction.Substitute(s))
+	}
+
+	references := make([]*ReactionReference, 0, len(group.References))
+	for _, ref := range group.References {
+		references = append(references, ref.Substitute(s))
+	}
+
+	return &ReactionGroup{Reactions: reactions, References: references, Fallback: group.Fallback.Substitute(s)}
+}
+
+// Substitutes into the arguments of the reference, returning a new reference.
+func (ref *ReactionReference) Substitute(s Substitution) *ReactionReference {
+	args := make([]IntegerTerm, 0, len(ref.Arguments))
+	for _, arg := range ref.Arguments {
+		args = append(args, arg.Substitute(s))
+	}
+	return &ReactionReference{Identifier: ref.Identifier, Arguments: args, Fallback: ref.Fallback}
+}
+
+// Substitutes into the products and condition of the reaction, returning a new reaction.
+// Identifiers which are bound by the reaction input or by local variables are not substituted.
+func (reaction *Reaction) Substitute(s Substitution) *Reaction {
+	bound := BoundIdentifiers(reaction.Input.Patterns)
+	for _, local := range reaction.Locals {
+		bound = append(bound, local.Identifier)
+	}
+	s = s.without(bound)
+
+	var locals []*LocalBinding
+	for _, local := range reaction.Locals {
+		locals = append(locals, &LocalBinding{Identifier: local.Identifier, Value: local.Value.Substitute(s)})
+	}
+
+	var alternatives []*ReactionAlternative
+	for _, alt := range reaction.Alternatives {
+		alternatives = append(alternatives, &ReactionAlternative{
+			Action:    alt.Action.Substitute(s),
+			Condition: &ReactionCondition{Expression: alt.Condition.Expression.Substitute(s)},
+		})
+	}
+
+	return &Reaction{
+		Kind:         reaction.Kind,
+		Input:        reaction.Input,
+		Action:       reaction.Action.Substitute(s),
+		Condition:    &ReactionCondition{Expression: reaction.Condition.Expression.Substitute(s)},
+		Alternatives: alternatives,
+		Locals:       locals,
+		Once:         reaction.Once,
+	}
+}
+
+// Substitutes into the products of the action, returning a new action
+func (action *ReactionAction) Substitute(s Substitution) *ReactionAction {
+	products := make([]Product, 0, len(action.Products))
+	for _, product := range action.Products {
+		products = append(products, substituteProduct(product, s))
+	}
+	return &ReactionAction{Products: products}
+}
+
+// Returns the identifiers which are bound by the patterns
+func BoundIdentifiers(patterns []Pattern) []Identifier {
+	var res []Identifier
+	for _, pattern := range patterns {
+		switch pattern := pattern.(type) {
+		case IdentifierTuple:
+			res = append(res, pattern.Values...)
+		case *SolutionPattern:
+			res = append(res, BoundIdentifiers(pattern.Patterns)...)
+		case *AirlockPattern:
+			res = append(res, BoundIdentifiers([]Pattern{pattern.Pattern})...)
+			res = append(res, pattern.Solution)
+		case *ReactionPattern:
+			res = append(res, pattern.Identifier)
+		}
+	}
+	return res
+}
+
+func substituteProduct(product Product, s Substitution) Product {
+	switch product := product.(type) {
+	case IntegerTermTuple:
+		values := make([]IntegerTerm, 0, product.Dimensions())
+		for _, value := range product.Values {
+			values = append(values, value.Substitute(s))
+		}
+		return IntegerTermTuple{Values: values}
+	case *SolutionProduct:
+		products := make([]Product, 0, len(product.Products))
+		for _, p := range product.Products {
+			products = append(products, substituteProduct(p, s))
+		}
+		return &SolutionProduct{Products: products}
+	case *AirlockProduct:
+		return &AirlockProduct{Product: substituteProduct(product.Product, s), Solution: product.Solution}
+	case *Reaction:
+		return product.Substitute(s)
+	default:
+		return product
+	}
+}
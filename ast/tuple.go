@@ -23,6 +23,8 @@ func (tuple IntegerTermTuple) Dimensions() int {
 	return len(tuple.Values)
 }
 
+func (IntegerTermTuple) product() {}
+
 func (tuple *IntegerTermTuple) String() string {
 	return fmt.Sprintf("intTermTuple(%s)", tuple.Values)
 }
@@ -36,6 +38,8 @@ func (tuple IdentifierTuple) Dimensions() int {
 	return len(tuple.Values)
 }
 
+func (IdentifierTuple) pattern() {}
+
 func (tuple *IdentifierTuple) String() string {
 	return fmt.Sprintf("identTuple(%s)", tuple.Values)
 }
@@ -0,0 +1,12 @@
+// Package docs contains the documentation of the language, and embeds the sample programs so that they can be shipped
+// as the standard library.
+package docs
+
+import (
+	_ "embed"
+)
+
+// The sample reaction definitions in programs.txt
+//
+//go:embed programs.txt
+var Programs []byte
@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"github.com/howden/cham/ast"
+	"github.com/pkg/errors"
+)
+
+// State used to test a split predicate against a molecule, which binds every identifier to the value of the molecule
+type moleculeState struct {
+	value     int
+	functions func(ident ast.Identifier) (*ast.FunctionDefinition, error)
+}
+
+func (s moleculeState) GetVar(_ ast.Identifier) (int, error) {
+	return s.value, nil
+}
+
+func (s moleculeState) GetFunction(ident ast.Identifier) (*ast.FunctionDefinition, error) {
+	return s.functions(ident)
+}
+
+// Function to evaluate a branch.
+// The solution is split between the branches, then the chain of stages in each branch is evaluated in parallel.
+// Afterwards, the solutions of the branches are merged back together.
+func (evaluator *Evaluator) evaluateBranch(branch *ast.Branch, multiset *Multiset) error {
+	solutions, err := evaluator.splitSolution(branch, multiset)
+	if err != nil {
+		return err
+	}
+
+	// Create a channel to receive status callbacks from child goroutines
+	c := make(chan error)
+
+	for i, stages := range branch.Branches {
+		go func(stages []ast.Stage, solution *Multiset) {
+			for _, stage := range stages {
+				if err := evaluator.evaluateStage(stage, solution); err != nil {
+					c <- err
+					return
+				}
+			}
+			c <- nil
+		}(stages, solutions[i])
+	}
+
+	// Wait for all goroutines to complete, returning the first error (if any)
+	for range branch.Branches {
+		if e := <-c; e != nil && err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Merge step: clear the original multiset, then re-add the solutions of each branch
+	multiset.Clear()
+	for _, solution := range solutions {
+		multiset.MergeFrom(solution)
+	}
+
+	return nil
+}
+
+// Splits the solution into a new solution for each branch
+func (evaluator *Evaluator) splitSolution(branch *ast.Branch, multiset *Multiset) ([]*Multiset, error) {
+	solutions := make([]*Multiset, 0, len(branch.Branches))
+
+	// Without a predicate, each branch receives a copy of the whole solution
+	if branch.Predicate == nil {
+		for range branch.Branches {
+			solutions = append(solutions, multiset.Copy())
+		}
+		return solutions, nil
+	}
+
+	// Otherwise, the molecules which satisfy the predicate go to the first branch, and the rest go to the second.
+	// Only single integers can be tested - all other molecules go to the second branch.
+	matched, rest := NewMultiset(), NewMultiset()
+	for _, molecule := range multiset.Slice() {
+		if !molecule.IsTuple() || molecule.Tuple.Shape != 1 {
+			rest.Add(molecule)
+			continue
+		}
+
+		ok, err := branch.Predicate.Eval(moleculeState{molecule.Tuple.Values[0], evaluator.resolveFunction})
+		if err != nil {
+			return nil, errors.Wrap(err, "error evaluating split predicate")
+		}
+
+		if ok {
+			matched.Add(molecule)
+		} else {
+			rest.Add(molecule)
+		}
+	}
+	return append(solutions, matched, rest), nil
+}
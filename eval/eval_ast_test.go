@@ -45,3 +45,18 @@ func TestBexp2(t *testing.T) {
 		t.Errorf("expected true but got false")
 	}
 }
+
+func TestDivisionByZero(t *testing.T) {
+	state := NewState()
+	state.PutVar(ast.Ident("x"), 0)
+
+	// 1 / x  ==>  error
+	if _, err := ast.Divide(ast.Number(1), ast.Ident("x")).Eval(state); err == nil {
+		t.Errorf("expected an error")
+	}
+
+	// 1 % x  ==>  error
+	if _, err := ast.Modulo(ast.Number(1), ast.Ident("x")).Eval(state); err == nil {
+		t.Errorf("expected an error")
+	}
+}
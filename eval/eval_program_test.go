@@ -0,0 +1,552 @@
+package eval_test
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/lexer"
+	"github.com/howden/cham/parser"
+	"github.com/howden/cham/std"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// A program, along with the result it is expected to give (or the error it is expected to fail with)
+type programTest struct {
+	src      string
+	expected string
+}
+
+// Parses and evaluates a program, returning the resultant multiset in sorted order
+func runProgram(src string, store *eval.ReactionStore) (string, error) {
+	program, _, err := parser.NewParser(lexer.FromString(src)).ParseProgramOrDefinitionFully(store)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := (&eval.Evaluator{Store: store}).Evaluate(program)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(sortedMolecules(result), " ")), nil
+}
+
+// Formats the molecules in a multiset (and any subsolutions) in sorted order
+func sortedMolecules(set *eval.Multiset) []string {
+	var values []string
+	for _, molecule := range set.Slice() {
+		if molecule.IsSolution() {
+			values = append(values, fmt.Sprintf("{%s}", strings.Join(sortedMolecules(molecule.Solution), " ")))
+		} else {
+			values = append(values, molecule.String())
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// Parses a list of definitions into the store, returning the store
+func define(t *testing.T, store *eval.ReactionStore, defs ...string) *eval.ReactionStore {
+	t.Helper()
+	for _, def := range defs {
+		_, definition, err := parser.NewParser(lexer.FromString(def)).ParseProgramOrDefinitionFully(store)
+		if err != nil {
+			t.Fatalf("error parsing definition %q: %v", def, err)
+		}
+		store.Define(definition)
+	}
+	return store
+}
+
+// Parses a list of definitions into a new store
+func defineReactions(t *testing.T, defs ...string) *eval.ReactionStore {
+	t.Helper()
+	return define(t, eval.NewReactionStore(), defs...)
+}
+
+// Runs each of the programs, checking that it gives the expected result
+func testPrograms(t *testing.T, store *eval.ReactionStore, tests []programTest) {
+	t.Helper()
+	for _, test := range tests {
+		actual, err := runProgram(test.src, store)
+		if err != nil {
+			t.Errorf("error running %q: %v", test.src, err)
+		} else if actual != test.expected {
+			t.Errorf("incorrect result for %q. expected=%s, got=%s", test.src, test.expected, actual)
+		}
+	}
+}
+
+// Runs each of the programs, checking that it fails with an error containing the expected text
+func testProgramErrors(t *testing.T, store *eval.ReactionStore, tests []programTest) {
+	t.Helper()
+	for _, test := range tests {
+		if _, err := runProgram(test.src, store); err == nil {
+			t.Errorf("expected error running %q", test.src)
+		} else if !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("incorrect error for %q. expected to contain %q, got=%q", test.src, test.expected, err.Error())
+		}
+	}
+}
+
+func TestParallelComposition(t *testing.T) {
+	store := defineReactions(t,
+		"max: x,y => x if x>y",
+		"filter_odd: x => {} if x%2 == 0",
+	)
+
+	testPrograms(t, store, []programTest{
+		{"{1,2,3,4,5,6} | x => {} if x%2 == 1 + x,y => x*y if x%2 == 0 && y%2 == 0", "[48]"},
+		{"{2,4,6,7,9} | :filter_odd + :max", "[9]"},
+		{"{1,2,3} | x, y => x + y + z => {} if z < 0", "[6]"},
+	})
+}
+
+func TestPriorityComposition(t *testing.T) {
+	store := defineReactions(t,
+		"filter_negative: x => {} if x < 0",
+		"sum: x,y => x+y",
+		"positive_sum: :filter_negative > :sum",
+	)
+
+	testPrograms(t, store, []programTest{
+		{"{1,-2,3,-4,5} | x => {} if x < 0 > x,y => x+y", "[9]"},
+		{"{1,-2,3,-4,5} | :positive_sum", "[9]"},
+		{"{1,-2,3,-4,5,6} | :filter_negative > x => {} if x > 4 > :sum", "[4]"},
+		{"{0,1,-2,3,0} | x => {} if x < 0 + x => {} if x == 0 > :sum", "[4]"},
+	})
+}
+
+func TestSubsolutions(t *testing.T) {
+	testPrograms(t, nil, []programTest{
+		{"{1, 2, {3, 4}, {5, {6, 7}}} | x,y => x+y", "[3 {5 {13}} {7}]"},
+		{"{1, 2, {3, 4}} | x,y => x+y | {x} => x", "[3 7]"},
+		{"{{1}, {2}, {3}} | {x}, {y} => {{x+y}}", "[{6}]"},
+		{"{{}, {1}, {2, 3}} | {} => 0 + {x, y} => {x, y} if x > y", "[0 2 3 {1}]"},
+		{"{1, {}} | {x} => x", "[1 {}]"},
+	})
+}
+
+func TestStructuralRules(t *testing.T) {
+	testPrograms(t, nil, []programTest{
+		{"{[1,2],[3,4]} | [p,q] ~> p, q | x,y => x+y", "[10]"},
+		{"{[1,2],[3,4]} | [p,q] ⇀ p, q | x,y => x+y", "[10]"},
+		{"{1,1} | [p,q] <~ p, q", "[[1 1]]"},
+		{"{[1,2],[1,2]} | [p,q] <~> p, q + x, y => x+y if x+y == 3", "[[3 3]]"},
+		{"{[1,2],[1,2]} | [p,q] ⇌ p, q + x, y => x+y if x+y == 3", "[[3 3]]"},
+		{"{{1, 2, 3}} | x <| s => x, s if x == 2", "[2 {1 3}]"},
+		{"{5, {1, 2}} | x, y <| s => x+y <| s if y == 1", "[{2 6}]"},
+		{"{5, {1, 2}} | x, y ◁ s => {x+y ◁ s} if y == 1", "[{2 6}]"},
+	})
+}
+
+func TestStructuralRuleTrace(t *testing.T) {
+	program, err := parser.NewParser(lexer.FromString("{[1,2],[1,2]} | [p,q] <~> p, q + x, y => x+y if x+y == 3")).ParseProgramFully()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	steps := make(map[ast.ReactionKind]int)
+	evaluator := &eval.Evaluator{Trace: func(step eval.Step) {
+		steps[step.Kind]++
+	}}
+
+	if _, err := evaluator.Evaluate(program); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[ast.ReactionKind]int{ast.HeatingRule: 2, ast.ReactionRule: 2, ast.CoolingRule: 1}
+	for kind, count := range expected {
+		if steps[kind] != count {
+			t.Errorf("incorrect number of %v steps. expected=%d, got=%d", kind, count, steps[kind])
+		}
+	}
+}
+
+func TestReactionMolecules(t *testing.T) {
+	testPrograms(t, nil, []programTest{
+		{"{(x, y => x+y), 1, 2, 3}", "[(reaction) 6]"},
+		{"{(x, y => x+y), 1, 2} | (r) => {}", "[1 2]"},
+		{"{(once x, y => x+y, (once z => z*10)), 1, 2}", "[30]"},
+		{"{(once x => x+1), (once x => x+1), 0}", "[2]"},
+		{"{3, 4, (once x => (once y => x*y))}", "[12]"},
+		{"{1, 2} | x, y => x+y, (z => z*2 if z < 100)", "[(reaction) 192]"},
+		{"{(x => {} if x < 0), 1, -2, {(x, y => x*y), 2, 3}}", "[(reaction) 1 {(reaction) 6}]"},
+		{"{1, 2, (once x => x*10)} | x => x+1 if x < 3 > (r) => {}", "[3 3]"},
+	})
+}
+
+func TestParameterisedDefinitions(t *testing.T) {
+	store := defineReactions(t,
+		"filter_mod(n): x => {} if x%n == 0",
+		"scale(a, b): x => x*a+b if x < 10",
+		"filter_twice(n): :filter_mod(n*2)",
+		"shadow(x): x => {} if x > 2",
+		"times(n): [a,b] => (once y => y*n*a*b)",
+	)
+
+	testPrograms(t, store, []programTest{
+		{"{1,2,3,4,5,6} | :filter_mod(3)", "[1 2 4 5]"},
+		{"{1,2,3,4,5,6} | :filter_mod(2) | :filter_mod(3)", "[1 5]"},
+		{"{1,2,3} | :scale(10, 1)", "[11 21 31]"},
+		{"{1,2,3,4,5,6} | :filter_twice(1+1)", "[1 2 3 5 6]"},
+		{"{1,2,3,4} | :shadow(10)", "[1 2]"},
+		{"{[1,2], 3} | :times(5)", "[30]"},
+	})
+}
+
+func TestLateBinding(t *testing.T) {
+	store := defineReactions(t,
+		"sum_twice: :twice | :sum",
+		"twice: x => [x*2, 0] | [x, y] => x",
+		"sum: x,y => x+y",
+	)
+	testPrograms(t, store, []programTest{{"{1,2,3} | :sum_twice", "[12]"}})
+
+	// redefining a reaction changes the reactions which refer to it
+	define(t, store, "sum: x,y => x*y")
+	testPrograms(t, store, []programTest{{"{1,2,3} | :sum_twice", "[48]"}})
+}
+
+func TestLateBindingErrors(t *testing.T) {
+	store := defineReactions(t,
+		"loop: :loop",
+		"ping: :pong",
+		"pong: x => x | :ping",
+		"chain: x => x+1 if x < 0 | x => x-1 if x > 0",
+		"uses_undefined: :undefined",
+	)
+
+	testProgramErrors(t, store, []programTest{
+		{"{1} | :loop", "reaction :loop refers to itself (:loop -> :loop)"},
+		{"{1} | :ping", "reaction :ping refers to itself (:ping -> :pong -> :ping)"},
+		{"{1} | :undefined", "undefined reaction :undefined"},
+		{"{1} | :uses_undefined", "undefined reaction :undefined"},
+		{"{1} | :chain + x => x", "reaction :chain is a chain of reactions, so cannot be composed"},
+	})
+}
+
+func TestLoops(t *testing.T) {
+	store := defineReactions(t,
+		"pair: x => [x,0]",
+		"inc_pair: [x,y] => x+1 if x < 5",
+		"count: (:pair | :inc_pair)*",
+	)
+
+	testPrograms(t, store, []programTest{
+		{"{1} | (x => [x,0] | [x,y] => x+1 if x < 5)*", "[[5 0]]"},
+		{"{1} | (x => [x,0] | [x,y] => x+1 if x < 5)*3", "[4]"},
+		{"{1, 3} | :count", "[[5 0] [5 0]]"},
+		{"{1} | (:pair | :inc_pair)*2 | x => [x*10, 1]", "[[30 1]]"},
+		{"{1} | ((:pair | :inc_pair)*2 | x => x*2 if x == 3)*", "[[6 0]]"},
+		{"{[1,2],[1,2]} | ([p,q] <~> p, q + x, y => x+y if x+y == 3)*", "[[3 3]]"},
+		{"{1, (x => [x,0] if x > 0)} | ((r) => {})*", "[1]"},
+	})
+}
+
+func TestBranches(t *testing.T) {
+	store := defineReactions(t,
+		"sum: x,y => x+y",
+		"product: x,y => x*y",
+		"even_odd: split(x%2 == 0) { :sum } { :product }",
+	)
+
+	testPrograms(t, store, []programTest{
+		{"{1,2,3,4,5,6} | split(x%2 == 0) { :sum } { :product }", "[12 15]"},
+		{"{1,2,3,4,5,6} | :even_odd | :sum", "[27]"},
+		{"{1,2,3} | split { :sum } { :product } { x => {} }", "[6 6]"},
+		{"{1,2,-3,4} | split(x < 0) {} { :sum }", "[-3 7]"},
+		{"{1,[2,3],{4}} | split(x > 0) { x => [x,x] } { [x,y] => x+y + {x} => x }", "[4 5 [1 1]]"},
+		{"{1,2,3,4} | split(x > 2) { x => x-2 if x > 2 } {}", "[1 1 2 2]"},
+	})
+}
+
+func TestNamedSolutions(t *testing.T) {
+	store := defineReactions(t, "max: x,y => x if x > y")
+
+	program, _, err := parser.NewParser(lexer.FromString("data = {1,2,4,7,3} | x => [x, 0]")).ParseProgramOrDefinitionFully(store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	result, err := (&eval.Evaluator{Store: store}).Evaluate(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.PutSolution(*program.Name, result)
+	store.PutSolution(ast.Ident("_"), eval.NewMultiset())
+
+	testPrograms(t, store, []programTest{
+		{"$data | [x, y] => x | :max", "[7]"},
+		{"{$data, 10} | [x, y] => x | :max", "[10]"},
+		{"{{$data}} | [x, y] => x", "[{1 2 3 4 7}]"},
+		{"$data | [x, y] => {} if x > 1", "[[1 0]]"},
+		{"_ | x => x", "[]"},
+		// the named solution is not changed by the programs which use it
+		{"$data | [x, y] => x + x, y => x+y", "[17]"},
+	})
+	testProgramErrors(t, store, []programTest{{"$undefined | :max", ""}})
+}
+
+func TestIdentifiers(t *testing.T) {
+	store := defineReactions(t,
+		"math.max: x, y => x if x > y",
+		"fn math.mid(a, b) = (a+b)/2",
+		"maxOf2: x2, y2 => x2 if x2 > y2",
+	)
+
+	testPrograms(t, store, []programTest{
+		{"{1, 2, 3} | xPrime => [xPrime, xPrime*2]", "[[1 2] [2 4] [3 6]]"},
+		{"{1, 2, 3} | x1, x2 => x1 + x2", "[6]"},
+		{"{1, 2, 3} | ünï => [ünï, 0]", "[[1 0] [2 0] [3 0]]"},
+		{"{1, 5, 3} | :math.max", "[5]"},
+		{"{1, 5, 3} | :maxOf2", "[5]"},
+		{"{[2, 10]} | [x, y] => math.mid(x, y)", "[6]"},
+		// step is only a keyword within a range, so it can be used as an identifier
+		{"{1..5 step 2} | step => [step, 0]", "[[1 0] [3 0] [5 0]]"},
+	})
+}
+
+func TestInputGenerators(t *testing.T) {
+	testPrograms(t, nil, []programTest{
+		{"{1..5}", "[1 2 3 4 5]"},
+		{"{-2..2}", "[-1 -2 0 1 2]"},
+		{"{1..9 step 3}", "[1 4 7]"},
+		{"{1..10 step 3}", "[1 10 4 7]"},
+		{"{0^3, 1}", "[0 0 0 1]"},
+		{"{3 * 5}", "[5 5 5]"},
+		{"{[1,2]^2}", "[[1 2] [1 2]]"},
+		{"{2 * 1..3}", "[1 1 2 2 3 3]"},
+		{"{1..3^2}", "[1 1 2 2 3 3]"},
+		{"{0 * 1, 0^0}", "[]"},
+		{"{{1..3}, 4}", "[4 {1 2 3}]"},
+		{"{2..1000} | x => {} if x > 3", "[2 3]"},
+		{"{1..100} | x, y => x+y", "[5050]"},
+		// ranges which end at (or start near) the largest and smallest ints
+		{"{-9223372036854775807..9223372036854775807 step 9223372036854775807}", "[-9223372036854775807 0 9223372036854775807]"},
+		{"{-9223372036854775807..-9223372036854775800 step 100}", "[-9223372036854775807]"},
+		{"{9223372036854775806..9223372036854775807}", "[9223372036854775806 9223372036854775807]"},
+		{"{9223372036854775800..9223372036854775807 step 4}", "[9223372036854775800 9223372036854775804]"},
+		{"{-9223372036854775807..-9223372036854775806}", "[-9223372036854775806 -9223372036854775807]"},
+	})
+	// generators which are each within the limit, but together exceed the maximum cardinality of a solution
+	testProgramErrors(t, nil, []programTest{
+		{"{0^16777216, 1}", "more than the maximum of 16777216 molecules"},
+		{"{8388608 * 0, 8388609 * 1}", "more than the maximum of 16777216 molecules"},
+	})
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	testPrograms(t, nil, []programTest{
+		{"{-3, 0, 5} | x => [abs(x), sign(x)]", "[[0 0] [3 -1] [5 1]]"},
+		{"{[8, 3]} | [x, y] => [min(x, y), max(x, y)] if x > y", "[[3 8]]"},
+		{"{[2, 10]} | [x, y] => pow(x, y)", "[1024]"},
+		{"{[5, 0]} | [x, y] => pow(x, y)", "[1]"},
+		{"{12, 18, 27} | x, y => gcd(x, y)", "[3]"},
+		{"{[-4, 6]} | [x, y] => gcd(x, y)", "[2]"},
+		{"{0, 1, 15, 16, 17} | x => [sqrt(x), 0]", "[[0 0] [1 0] [3 0] [4 0] [4 0]]"},
+		{"{1..20} | x => {} if sqrt(x) * sqrt(x) != x", "[1 16 4 9]"},
+		{"{9223372036854775807} | x => [sqrt(x), 0]", "[[3037000499 0]]"},
+		{"{9223372030926249001, 9223372030926249000} | x => [sqrt(x), 0]", "[[3037000498 0] [3037000499 0]]"},
+		{"{1, 2, 3} | x, y => max(x, y) + min(x, y)", "[6]"},
+		{"{[1, 2]} | [x, y] => pow(max(x, y), abs(x - 4))", "[8]"},
+	})
+	testProgramErrors(t, nil, []programTest{
+		{"{-1} | x => [sqrt(x), 0]", "error calling sqrt: square root of negative number -1"},
+		{"{[2, -1]} | [x, y] => pow(x, y)", "error calling pow: negative exponent -1"},
+	})
+}
+
+func TestUserFunctions(t *testing.T) {
+	store := defineReactions(t,
+		"fn mid(a, b) = (a+b)/2",
+		"fn square(x) = x*x",
+		"fn dist(a, b) = abs(a - b)",
+		"fn hyp(a, b) = sqrt(square(a) + square(b))",
+		"fn forever(n) = forever(n + 1)",
+		"closest: x, y => y if dist(x, 10) > dist(y, 10)",
+	)
+
+	testPrograms(t, store, []programTest{
+		{"{[2, 10]} | [x, y] => mid(x, y)", "[6]"},
+		{"{1, 2, 3} | x => [x, square(x)]", "[[1 1] [2 4] [3 9]]"},
+		{"{[3, 4]} | [x, y] => hyp(x, y)", "[5]"},
+		{"{1, 7, 14, 20} | :closest", "[7]"},
+		{"{1..10} | x => {} if square(mid(x, 0)) > 10", "[1 2 3 4 5 6 7]"},
+		{"{1..6} | split(square(x) < 10) { x, y => x+y } { x, y => x*y }", "[120 6]"},
+	})
+	testProgramErrors(t, store, []programTest{
+		{"{1} | x => [undefined(x), 0]", ""},
+		{"{1} | x => [mid(x), 0]", ""},
+		{"{1} | x => [forever(x), 0]", ""},
+	})
+}
+
+func TestConditionalExpressions(t *testing.T) {
+	store := defineReactions(t,
+		"fn fact(n) = if n <= 1 then 1 else n * fact(n - 1)",
+		"fn fib(n) = if n < 2 then n else fib(n - 1) + fib(n - 2)",
+		"fn collatz(n) = if n == 1 then 0 else 1 + collatz(if n % 2 == 0 then n / 2 else 3 * n + 1)",
+	)
+
+	testPrograms(t, store, []programTest{
+		{"{3, 9, 4} | x, y => if x > y then x else y", "[9]"},
+		{"{[4, -2]} | [x, y] => if x > y then x - y else y - x", "[6]"},
+		{"{[1, 2]} | [x, y] => (if x > y then x else y) + 10", "[12]"},
+		{"{[1, 2]} | [x, y] => if x > y then x else y + 10", "[12]"},
+		{"{1..4} | x => [x, if x % 2 == 0 then 1 else 0]", "[[1 0] [2 1] [3 0] [4 1]]"},
+		{"{1..4} | x => [x, 0] if 0 < (if x > 2 then x else 0)", "[1 2 [3 0] [4 0]]"},
+		{"{[2, 0]} | [x, y] => if y == 0 then 0 else x / y", "[0]"},
+		{"{0, 1, 5, 10} | x => [fact(x), fib(x)]", "[[1 0] [1 1] [120 5] [3628800 55]]"},
+		{"{1, 6, 27} | x => [collatz(x), 0]", "[[0 0] [111 0] [8 0]]"},
+	})
+}
+
+func TestReactionAlternatives(t *testing.T) {
+	store := defineReactions(t, "pick(n): x => [x, 1] if x > n else [x, 0]")
+
+	testPrograms(t, store, []programTest{
+		{"{1..6} | x => {} if x % 3 == 0 else [x, 1] if x % 2 == 0 else [x, 0]", "[[1 0] [2 1] [4 1] [5 0]]"},
+		{"{[1, 2], [3, 3], [5, 4]} | [x, y] => x if x > y else y if y > x else 0", "[0 2 5]"},
+		{"{[1, 2], [3, 3]} | [x, y] => x if x > y else y if y > x", "[2 [3 3]]"},
+		{"{1, 5, 3, 5} | x, y => x if x > y else y if y > x", "[5 5]"},
+		{"{1, 2, 3} | x, y => x + y if x > 10 else {} if x == y else x * y", "[6]"},
+		{"{1, 7, (once y => [y, 1] if y > 5 else [y, 0] if y > 3)}", "[1 [7 1]]"},
+		{"{1, 2} | :pick(4)", "[[1 0] [2 0]]"},
+	})
+}
+
+func TestLocalBindings(t *testing.T) {
+	store := defineReactions(t, "scale(n): x => [x, m] where m = x * n")
+
+	testPrograms(t, store, []programTest{
+		{"{[1, 8]} | [x, y] => {[x, m], [m+1, y]} if x != y where m = (x+y)/2 | [x, y] => x", "[1 2 3 4 5 6 7 8]"},
+		{"{1..5} | x => [x, n] if n > 6 where m = x*2, n = m+1", "[1 2 [3 7] [4 9] [5 11]]"},
+		{"{1, 2, 3} | x, y => s if s > 0 where s = x + y", "[6]"},
+		{"{1..4} | x => {} if h == 0 else [x, h] where h = x % 2", "[[1 1] [3 1]]"},
+		{"{1, 2} | :scale(3)", "[[1 3] [2 6]]"},
+		{"{2, 5, (once y => [y, m] if m > 20 where m = y * 10)}", "[2 [5 50]]"},
+		// a local which can't be evaluated doesn't stop the guard from rejecting the reactants
+		{"{6, 0, 3} | x, y => m if y != 0 && x > y where m = x / y", "[0 2]"},
+		{"{0, 1} | x => {} if x == 0 else [x, m] where m = 10 / x", "[[1 10]]"},
+	})
+	testProgramErrors(t, store, []programTest{
+		{"{6, 0} | x, y => m if x > y where m = x / y", "error evaluating local variable m: division by zero"},
+		{"{0} | x => n where m = 1 / x, n = m + 1", "error evaluating local variable m: division by zero"},
+	})
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		exp      string
+		expected string
+	}{
+		{"x - y - 2", "[5]"},
+		{"100 / x / 2", "[5]"},
+		{"x - y + 2", "[9]"},
+		{"x + y * 2", "[16]"},
+		{"(x + y) * 2", "[26]"},
+		{"x % y * 2", "[2]"},
+		{"2 ** 3 ** 2", "[512]"},
+		{"-2 ** 2", "[-4]"},
+		{"(-2) ** 2", "[4]"},
+		{"-x * y", "[-30]"},
+		{"-(x + y)", "[-13]"},
+		{"x - -y", "[13]"},
+		{"y ** 2 * 2", "[18]"},
+		{"x & y", "[2]"},
+		{"x | y", "[11]"},
+		{"x ^ y", "[9]"},
+		{"~x", "[-11]"},
+		{"x << 2", "[40]"},
+		{"x >> 1", "[5]"},
+		{"x | y & 2", "[10]"},
+		{"x ^ y | 4", "[13]"},
+		{"x & y ^ 1", "[3]"},
+		{"1 << y + 1", "[16]"},
+		{"x - 1 >> 1 << 1", "[8]"},
+		{"~x + 1", "[-10]"},
+		{"~-x", "[9]"},
+		{"x << -1", "error"},
+		{"2 ** -y * 0 + 1", "error"},
+		{"x / (y - 3)", "error"},
+		{"x % 0", "error"},
+	}
+
+	var programs, failures []programTest
+	for _, test := range tests {
+		src := fmt.Sprintf("{[10, 3]} | [x, y] => %s", test.exp)
+		if test.expected == "error" {
+			failures = append(failures, programTest{src, ""})
+		} else {
+			programs = append(programs, programTest{src, test.expected})
+		}
+	}
+	testPrograms(t, nil, programs)
+	testProgramErrors(t, nil, failures)
+}
+
+func TestBooleanPrecedence(t *testing.T) {
+	testPrograms(t, nil, []programTest{
+		{"{1..6} | x => {} if (x+1) % 3 == 0", "[1 3 4 6]"},
+		{"{1..6} | x => {} if x < 2 || x > 3 && x < 6", "[2 3 6]"},
+		{"{1..6} | x => {} if (x < 2 || x > 3) && x < 6", "[2 3 6]"},
+		{"{1..6} | x => {} if !x > 2 && x != 1", "[1 3 4 5 6]"},
+		{"{1..6} | x => {} if !(x > 2 && x != 5)", "[3 4 6]"},
+		{"{1..6} | x => {} if ((x)) * 2 > 8", "[1 2 3 4]"},
+		{"{3, 4} | x, y => x if x > y > x => {}", "[]"},
+		{"{1..6} | x => {} if x<~-4", "[3 4 5 6]"},
+	})
+}
+
+func TestBitwiseOrAndReactionChain(t *testing.T) {
+	store := defineReactions(t, "sum: x, y => x + y")
+
+	testPrograms(t, store, []programTest{
+		{"{12, 10} | x, y => x | y", "[14]"},
+		{"{12, 10} | x, y => x | y | x => [x, 0]", "[[14 0]]"},
+		{"{12, 10} | x, y => x | y | :sum", "[14]"},
+		{"{1..8} | x => {} if x & 1 == 1 | x, y => x | y", "[14]"},
+		{"{1, 2} | x => [x | 4, 0] | ([x, y] => x)*", "[5 6]"},
+		{"{1, 2} | x => [x | 4, 0] | split { [x, y] => x } {}", "[5 6 [5 0] [6 0]]"},
+		{"{1, 2} | x => [x | (x + 2), 0] | (r) => {}", "[[3 0] [6 0]]"},
+	})
+}
+
+func TestStd(t *testing.T) {
+	store := eval.NewReactionStore()
+	if err := std.Load(store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testPrograms(t, store, []programTest{
+		{"{4, 8, 1, 3} | :max", "[8]"},
+		{"{4, 8, 1, 3} | :min", "[1]"},
+		{"{1, 2, 2, 3, 3, 3} | :remove_duplicates", "[1 2 3]"},
+		{"{1..10} | :sum", "[55]"},
+		{"{1..5} | :product", "[120]"},
+		{"{1..6} | :filter_odd", "[1 3 5]"},
+		{"{1..6} | :filter_even", "[2 4 6]"},
+		{"{2..20} | :prime_sieve", "[11 13 17 19 2 3 5 7]"},
+		{"{10} | :fib", "[55]"},
+		{"{5, 3, 9, 1} | :sort", "[[0 1] [1 3] [2 5] [3 9]]"},
+		{"{[0, 3], [1, 1], [2, 2]} | :sort_existing", "[[0 1] [1 2] [2 3]]"},
+		{"{[1, 4]} | :iota", "[1 2 3 4]"},
+		{"{20} | :primes", "[11 13 17 19 2 3 5 7]"},
+		{"{5} | :factorial", "[120]"},
+		{"{[0, 2], [1, -5], [2, 3], [3, 4], [4, -1]} | :max_segment_sum", "[[7 3]]"},
+		{"{[2, 12, 0], [3, 12, 0]} | :prime_factorization_coeff", "[[2 2] [3 1]]"},
+		{"{60} | x => [2, x], [3, x], [5, x] | [n, p] => [n, p, 0] | :prime_factorization", "[2 2 3 5]"},
+		// std definitions can also be referred to using the namespace
+		{"{4, 8, 1, 3} | :std.max", "[8]"},
+	})
+
+	// a user definition shadows the std definition, but not the references within the std library
+	define(t, store, "max: x, y => y if x > y", "iota: x => {}")
+	testPrograms(t, store, []programTest{
+		{"{4, 8, 1, 3} | :max", "[1]"},
+		{"{4, 8, 1, 3} | :std.max", "[8]"},
+		{"{20} | :primes", "[11 13 17 19 2 3 5 7]"},
+	})
+}
@@ -1,20 +1,56 @@
 package eval
 
 import (
+	"fmt"
 	"github.com/howden/cham/analysis"
 	"github.com/howden/cham/ast"
 	"github.com/pkg/errors"
 	"gonum.org/v1/gonum/stat/combin"
+	"sync/atomic"
 )
 
+// Holds the options used when evaluating programs.
+type Evaluator struct {
+	// Counts the reactions which have taken place, which is used to tell when a loop has stopped changing the
+	// solution. This is accessed atomically, so must be the first field to guarantee 64-bit alignment.
+	reactions int64
+
+	// Function which is called for every step (reaction) that takes place during evaluation.
+	// Steps may be traced concurrently. Can be nil if tracing is not required.
+	Trace func(step Step)
+
+	// Holds the defined reactions, which are used to resolve the references in a program.
+	// Can be nil if the program does not reference any defined reactions.
+	Store *ReactionStore
+}
+
 // Function to evaluate a program.
 func Evaluate(prog *ast.Program) (*Multiset, error) {
+	return (&Evaluator{}).Evaluate(prog)
+}
+
+// Function to evaluate a program.
+func (evaluator *Evaluator) Evaluate(prog *ast.Program) (*Multiset, error) {
 	// Create a new multiset containing the program input
 	multiset := NewMultiset()
-	multiset.AddAll(prog.Input)
+	if err := multiset.AddAll(prog.Input, evaluator.resolveSolution); err != nil {
+		return nil, errors.Wrap(err, "error creating program input")
+	}
 
-	for _, reaction := range prog.Reactions {
-		err := evaluateReaction(reaction, multiset)
+	// Resolve the references to defined reactions
+	stages, err := evaluator.resolveStages(prog.Reactions, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error resolving reactions")
+	}
+
+	// A program without a reaction chain is still evaluated (as an empty group of reactions),
+	// so that any reaction molecules in the input can take place
+	if len(stages) == 0 {
+		stages = []ast.Stage{&ast.ReactionGroup{}}
+	}
+
+	for _, stage := range stages {
+		err := evaluator.evaluateStage(stage, multiset)
 		if err != nil {
 			return nil, errors.Wrap(err, "error evaluating reaction")
 		}
@@ -23,21 +59,81 @@ func Evaluate(prog *ast.Program) (*Multiset, error) {
 	return multiset, nil
 }
 
-// Function to evaluate a reaction.
-func evaluateReaction(prog *ast.Reaction, multiset *Multiset) error {
+// Function to evaluate a single stage of the reaction chain.
+func (evaluator *Evaluator) evaluateStage(stage ast.Stage, multiset *Multiset) error {
+	switch stage := stage.(type) {
+	case *ast.Reaction:
+		// A single reaction is evaluated as a group containing only itself
+		return evaluator.evaluateReaction(&ast.ReactionGroup{Reactions: []*ast.Reaction{stage}}, multiset)
+	case *ast.ReactionGroup:
+		return evaluator.evaluateReaction(stage, multiset)
+	case *ast.Loop:
+		return evaluator.evaluateLoop(stage, multiset)
+	case *ast.Branch:
+		return evaluator.evaluateBranch(stage, multiset)
+	default:
+		return fmt.Errorf("unknown stage %v", stage)
+	}
+}
+
+// Function to evaluate a loop.
+// The stages of the loop are evaluated repeatedly until an iteration takes place without any reactions, or the
+// maximum number of iterations is reached. Structural (heating and cooling) rules are not counted as reactions, as
+// they do not change the solution.
+func (evaluator *Evaluator) evaluateLoop(loop *ast.Loop, multiset *Multiset) error {
+	for i := 0; loop.Limit == 0 || i < loop.Limit; i++ {
+		before := atomic.LoadInt64(&evaluator.reactions)
+
+		for _, stage := range loop.Stages {
+			err := evaluator.evaluateStage(stage, multiset)
+			if err != nil {
+				return err
+			}
+		}
+
+		if atomic.LoadInt64(&evaluator.reactions) == before {
+			return nil
+		}
+	}
+	return nil
+}
+
+// Function to evaluate a group of reactions.
+func (evaluator *Evaluator) evaluateReaction(prog *ast.ReactionGroup, multiset *Multiset) error {
+	// Reactions take place within subsolutions first - a subsolution can
+	// only react as a whole once its contents are stable
+	for _, subsolution := range multiset.Subsolutions() {
+		err := evaluator.evaluateReaction(prog, subsolution)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Groups containing structural rules are evaluated in phases
+	if heating, reactions, cooling := splitStructuralRules(prog); heating != nil || cooling != nil {
+		return evaluator.evaluateStructural(heating, reactions, cooling, multiset)
+	}
+
+	// Groups with a priority order cannot be partitioned, as the priority must be
+	// respected across the whole multiset, not just within each partition.
+	// Empty groups (where only reaction molecules can take place) are not partitioned either.
+	if prog.Fallback != nil || len(prog.Reactions) == 0 {
+		return evaluator.performReactions(prog, multiset, -1)
+	}
+
 	// Complete reactions in parallel
-	if analysis.DetermineReactionType(prog) == analysis.Expanding {
-		err := executeParallelReactionExpanding(prog, multiset)
+	if analysis.DetermineGroupType(prog) == analysis.Expanding {
+		err := evaluator.executeParallelReactionExpanding(prog, multiset)
 		if err != nil {
 			return err
 		}
-	} else if analysis.DetermineReactionType(prog) == analysis.Shrinking {
-		err := executeParallelReactionShrinking(prog, multiset)
+	} else if analysis.DetermineGroupType(prog) == analysis.Shrinking {
+		err := evaluator.executeParallelReactionShrinking(prog, multiset)
 		if err != nil {
 			return err
 		}
 	} else { // Constant
-		err := executeParallelReactionConstant(prog, multiset)
+		err := evaluator.executeParallelReactionConstant(prog, multiset)
 		if err != nil {
 			return err
 		}
@@ -49,20 +145,95 @@ func evaluateReaction(prog *ast.Reaction, multiset *Multiset) error {
 	// For "expanding" reactions, this final pass is less likely to be necessary, but in certain edge cases,
 	// there is a possibility for left-over molecules that can still react. For example if the reaction has conditions
 	// depending on the relations between more than one input, some reactions may have been blocked due to partitioning.
-	return performReactions(prog, multiset, -1)
+	return evaluator.performReactions(prog, multiset, -1)
+}
+
+// Evaluation implementation for groups containing structural (heating and cooling) rules.
+//
+// Heating rules take priority over the reactions, so molecules are always broken down into a form which is able to
+// react before any reactions take place. Once no more heating or reactions can happen, the solution is cooled by
+// applying the cooling rules until it is stable.
+func (evaluator *Evaluator) evaluateStructural(heating *ast.ReactionGroup, reactions *ast.ReactionGroup, cooling *ast.ReactionGroup, multiset *Multiset) error {
+	active := reactions
+	if heating != nil {
+		heating.Fallback = reactions
+		active = heating
+	}
+
+	if active != nil {
+		err := evaluator.performReactions(active, multiset, -1)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cooling != nil {
+		return evaluator.performCooling(cooling, multiset)
+	}
+	return nil
+}
+
+// Applies the cooling rules until the solution is stable.
+// Subsolutions are cooled first, as subsolutions created during the reactions will not have been cooled yet.
+func (evaluator *Evaluator) performCooling(cooling *ast.ReactionGroup, multiset *Multiset) error {
+	for _, subsolution := range multiset.Subsolutions() {
+		err := evaluator.performCooling(cooling, subsolution)
+		if err != nil {
+			return err
+		}
+	}
+	return evaluator.performReactions(cooling, multiset, -1)
+}
+
+// Splits the rules in a group into new groups of heating rules, reactions and cooling rules.
+// The priority order of the reactions is preserved. Any of the returned groups may be nil if there are no such rules.
+func splitStructuralRules(prog *ast.ReactionGroup) (heating *ast.ReactionGroup, reactions *ast.ReactionGroup, cooling *ast.ReactionGroup) {
+	var heatingRules, coolingRules []*ast.Reaction
+	var tiers []*ast.ReactionGroup
+
+	for group := prog; group != nil; group = group.Fallback {
+		tier := &ast.ReactionGroup{}
+		for _, reaction := range group.Reactions {
+			switch reaction.Kind {
+			case ast.HeatingRule:
+				heatingRules = append(heatingRules, reaction)
+			case ast.CoolingRule:
+				coolingRules = append(coolingRules, reaction)
+			default:
+				tier.Reactions = append(tier.Reactions, reaction)
+			}
+		}
+		if len(tier.Reactions) > 0 {
+			tiers = append(tiers, tier)
+		}
+	}
+
+	// Link the remaining reaction tiers back together in priority order
+	for i := len(tiers) - 1; i >= 0; i-- {
+		tiers[i].Fallback = reactions
+		reactions = tiers[i]
+	}
+
+	if len(heatingRules) > 0 {
+		heating = &ast.ReactionGroup{Reactions: heatingRules}
+	}
+	if len(coolingRules) > 0 {
+		cooling = &ast.ReactionGroup{Reactions: coolingRules}
+	}
+	return heating, reactions, cooling
 }
 
 // Parallel evaluation implementation for expanding reactions (reactions that produce more outputs than inputs).
 // The general approach is to split the input multiset into partitions of size=1, then perform a single reaction on each
 // partition separately in parallel, then repeat this (still in parallel) if the solution changed, and eventually
 // merge the multisets back together at the end.
-func executeParallelReactionExpanding(prog *ast.Reaction, multiset *Multiset) error {
+func (evaluator *Evaluator) executeParallelReactionExpanding(prog *ast.ReactionGroup, multiset *Multiset) error {
 	return executeParallelReaction(multiset, 1 /* partition size */, func(partition *Multiset) error {
 		// First, record the starting cardinality of the partition
 		before := partition.Cardinality()
 
 		// Then, attempt to perform a single reaction 'step' on the solution
-		err := performReactions(prog, partition, 1)
+		err := evaluator.performReactions(prog, partition, 1)
 		if err != nil {
 			return err
 		}
@@ -70,7 +241,7 @@ func executeParallelReactionExpanding(prog *ast.Reaction, multiset *Multiset) er
 		// If the multiset expanded as a result of the reaction, recursively call 'executeParallelReactionExpanding'
 		// to partition again and repeat this process
 		if partition.Cardinality() > before {
-			err = executeParallelReactionExpanding(prog, partition)
+			err = evaluator.executeParallelReactionExpanding(prog, partition)
 			if err != nil {
 				return err
 			}
@@ -84,14 +255,14 @@ func executeParallelReactionExpanding(prog *ast.Reaction, multiset *Multiset) er
 // The general approach is to split the input multiset into partitions of size=8, then perform reactions on each
 // partition separately in parallel, increasing the partition size after each iteration by increments of 8, and
 // eventually merging the multisets back together at the end.
-func executeParallelReactionShrinking(prog *ast.Reaction, multiset *Multiset) error {
+func (evaluator *Evaluator) executeParallelReactionShrinking(prog *ast.ReactionGroup, multiset *Multiset) error {
 	partitionSize := 8
 
 	for partitionSize*2 < multiset.Cardinality() {
 		before := multiset.Cardinality()
 
 		err := executeParallelReaction(multiset, partitionSize, func(partition *Multiset) error {
-			return performReactions(prog, partition, -1)
+			return evaluator.performReactions(prog, partition, -1)
 		})
 		if err != nil {
 			return err
@@ -113,9 +284,9 @@ func executeParallelReactionShrinking(prog *ast.Reaction, multiset *Multiset) er
 // have inputs).
 // The general approach is to split the input multiset into partitions of size=32, then perform reactions on each
 // partition separately in parallel, then merge the multisets back together at the end.
-func executeParallelReactionConstant(prog *ast.Reaction, multiset *Multiset) error {
+func (evaluator *Evaluator) executeParallelReactionConstant(prog *ast.ReactionGroup, multiset *Multiset) error {
 	return executeParallelReaction(multiset, 32 /* partition size */, func(partition *Multiset) error {
-		return performReactions(prog, partition, -1)
+		return evaluator.performReactions(prog, partition, -1)
 	})
 }
 
@@ -155,22 +326,19 @@ func executeParallelReaction(multiset *Multiset, partitionSize int, f func(parti
 }
 
 // Performs reactions exhaustively (until no more can happen)
-func performReactions(prog *ast.Reaction, multiset *Multiset, limit int) error {
-
-	// Obtain a list of the identifiers used by the (single) reaction rule
-	// The length of this array becomes 'k' in the k-permutations calculation
-	k := len(prog.Input.Idents)
-
+func (evaluator *Evaluator) performReactions(prog *ast.ReactionGroup, multiset *Multiset, limit int) error {
 	// Keep track of number of reactions performed
 	count := 0
 
+	// Keep track of which reaction in each group to attempt first.
+	// This is rotated after each reaction so that every reaction in a group gets a fair chance to take place.
+	first := make(map[*ast.ReactionGroup]int)
+
 	// Continuously attempt reactions until either:
-	// - 'n < k' where n is the cardinality of the multiset and k is the number of identifiers
-	//     i.e. there's more variables in the reaction than there are values to fill them
-	// - a previous iteration of the loop was unable to complete a single reaction
+	// - a previous iteration of the loop was unable to complete a single reaction using any rule in the group
 	// - the number of reactions performed >= limit
-	for multiset.Cardinality() >= k {
-		didReactionOccur, err := attemptReaction(prog, k, multiset)
+	for {
+		didReactionOccur, err := evaluator.attemptGroupReaction(prog, multiset, first)
 		if err != nil {
 			return err
 		}
@@ -186,15 +354,82 @@ func performReactions(prog *ast.Reaction, multiset *Multiset, limit int) error {
 			return nil
 		}
 	}
+}
 
-	return nil
+// Attempts to perform a single reaction using any of the reactions in the group.
+//
+// The reactions in the group's fallback (lower priority) group are only attempted
+// if none of the reactions in the group itself are able to take place.
+// The reaction molecules in the multiset have the lowest priority of all.
+func (evaluator *Evaluator) attemptGroupReaction(prog *ast.ReactionGroup, multiset *Multiset, first map[*ast.ReactionGroup]int) (bool, error) {
+	for group := prog; group != nil; group = group.Fallback {
+		for i := range group.Reactions {
+			index := (first[group] + i) % len(group.Reactions)
+			reaction := group.Reactions[index]
+
+			// Obtain a list of the patterns used by the reaction rule
+			// The length of this array becomes 'k' in the k-permutations calculation
+			k := len(reaction.Input.Patterns)
+
+			// If 'n < k' where n is the cardinality of the multiset and k is the number of patterns
+			// (i.e. there's more patterns in the reaction than there are molecules to match them), skip the reaction
+			if multiset.Cardinality() < k {
+				continue
+			}
+
+			ok, err := evaluator.attemptReaction(reaction, nil, prog, k, multiset)
+			if err != nil {
+				return false, err
+			}
+
+			if ok {
+				first[group] = index + 1
+				return true, nil
+			}
+		}
+	}
+
+	return evaluator.attemptMoleculeReaction(prog, multiset)
+}
+
+// Attempts to perform a single reaction using any of the reaction molecules in the multiset.
+//
+// The reaction molecule is taken out of the multiset while the reaction is attempted, so that it cannot be one of
+// its own reactants. Afterwards it is put back, unless it is a 'once' reaction that took place.
+func (evaluator *Evaluator) attemptMoleculeReaction(group *ast.ReactionGroup, multiset *Multiset) (bool, error) {
+	for _, molecule := range multiset.Reactions() {
+		reaction := molecule.Reaction
+		k := len(reaction.Input.Patterns)
+
+		if multiset.Cardinality()-1 < k {
+			continue
+		}
+
+		multiset.Take(molecule)
+		ok, err := evaluator.attemptReaction(reaction, molecule.Bindings, group, k, multiset)
+		if !ok || !reaction.Once {
+			multiset.Add(molecule)
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
 
 // Attempts to perform a single reaction within the multiset (solution).
 //
 // If/when a reaction takes place, the function will return immediately (with the value true).
 // If after trying using all possible permutations a reaction has not taken place, the function will return false.
-func attemptReaction(prog *ast.Reaction, k int, multiset *Multiset) (bool, error) {
+// The group containing the reaction is used to react any subsolutions created by the reaction.
+// The bindings hold the variables captured by a reaction molecule, and can be nil.
+func (evaluator *Evaluator) attemptReaction(prog *ast.Reaction, bindings *SimpleState, group *ast.ReactionGroup, k int, multiset *Multiset) (bool, error) {
 	// Create a copy of the multiset as a slice (array), containing all values
 	// len(multisetSlice) == multiset.Cardinality()
 	multisetSlice := multiset.Slice()
@@ -213,12 +448,12 @@ func attemptReaction(prog *ast.Reaction, k int, multiset *Multiset) (bool, error
 		generator.Permutation(permutation)
 
 		// Extract reactants from the multiset
-		reactants := make([]ast.IntTuple, k)
+		reactants := make([]Molecule, k)
 		for i := 0; i < k; i++ {
 			reactants[i] = multisetSlice[permutation[i]]
 		}
 
-		ok, err := performReaction(prog, k, multiset, reactants)
+		ok, err := evaluator.performReaction(prog, bindings, group, k, multiset, reactants)
 		if err != nil {
 			return false, err
 		}
@@ -231,54 +466,165 @@ func attemptReaction(prog *ast.Reaction, k int, multiset *Multiset) (bool, error
 	return false, nil
 }
 
-// Attempts to perform a reaction using the given reactants on the multiset.
-// Returns true if a reaction took place, false otherwise.
-func performReaction(prog *ast.Reaction, k int, multiset *Multiset, reactants []ast.IntTuple) (bool, error) {
-	// Create & populate a new state to hold the program variables during the reaction
-	programVariables := NewState()
-
-	for i := 0; i < k; i++ {
-		identTuple := prog.Input.Idents[i]
-		valueTuple := reactants[i]
+// Selects the action of a reaction to perform, by testing the reaction condition, followed by the condition of each
+// alternative in order. Returns nil if none of the conditions are satisfied.
+func selectAction(prog *ast.Reaction, state *SimpleState) (*ast.ReactionAction, error) {
+	cond, err := prog.Condition.Expression.Eval(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "error evaluating reaction condition")
+	}
+	if cond {
+		return prog.Action, nil
+	}
 
-		// If the shape of the identifier tuple doesn't match the shape of the value tuple,
-		// then a reaction is not possible, return false
-		if !ast.ShapeMatches(identTuple, valueTuple) {
-			return false, nil
+	for _, alt := range prog.Alternatives {
+		cond, err := alt.Condition.Expression.Eval(state)
+		if err != nil {
+			return nil, errors.Wrap(err, "error evaluating reaction condition")
 		}
-
-		for i, ident := range identTuple.Values {
-			programVariables.PutVar(ident, valueTuple.Values[i])
+		if cond {
+			return alt.Action, nil
 		}
 	}
+	return nil, nil
+}
 
-	// Test the reaction condition - if it evaluates true, then a reaction can take place.
-	cond, err := prog.Condition.Expression.Eval(programVariables)
+// Attempts to perform a reaction using the given reactants on the multiset.
+// Returns true if a reaction took place, false otherwise.
+func (evaluator *Evaluator) performReaction(prog *ast.Reaction, bindings *SimpleState, group *ast.ReactionGroup, k int, multiset *Multiset, reactants []Molecule) (bool, error) {
+	// Create a new state to hold the program variables during the reaction,
+	// starting with any variables captured by a reaction molecule
+	programVariables := NewState()
+	if bindings != nil {
+		programVariables = bindings.Copy()
+	}
+	programVariables.functions = evaluator.resolveFunction
+
+	// Match the reactants against the reaction input, populating the state.
+	// For each possible way of matching, test the reaction condition - if it evaluates true, then a reaction can take
+	// place. If the reactants cannot be matched at all (e.g. the shapes of the tuples don't match), then a reaction is
+	// not possible, return false
+	var action *ast.ReactionAction
+	matched, err := matchPatterns(prog.Input.Patterns, reactants, programVariables, func() (bool, error) {
+		// A local which can't be evaluated (e.g. dividing by zero) is only an error if the guard or the products use it
+		for _, local := range prog.Locals {
+			val, err := local.Value.Eval(programVariables)
+			if err != nil {
+				programVariables.PutVarError(local.Identifier, errors.Wrapf(err, "error evaluating local variable %s", local.Identifier.Name()))
+				continue
+			}
+			programVariables.PutVar(local.Identifier, val)
+		}
+
+		var err error
+		action, err = selectAction(prog, programVariables)
+		return action != nil, err
+	})
 	if err != nil {
-		return false, errors.Wrap(err, "error evaluating reaction condition")
+		return false, err
 	}
 
-	if !cond {
+	if !matched {
 		return false, nil
 	}
 
+	// Create the reaction outputs (products)
+	products := make([]Molecule, 0, len(action.Products))
+	for _, product := range action.Products {
+		molecule, err := evaluator.createProduct(product, group, programVariables)
+		if err != nil {
+			return false, err
+		}
+		products = append(products, molecule)
+	}
+
 	// Remove the reaction inputs from the multiset
 	for i := 0; i < k; i++ {
 		multiset.Take(reactants[i])
 	}
 
 	// Add the reaction outputs (products) to the multiset
-	for _, aexpTuple := range prog.Action.Products {
-		products := make([]int, 0, aexpTuple.Dimensions())
-		for _, aexp := range aexpTuple.Values {
-			product, err := aexp.Eval(programVariables)
+	for _, molecule := range products {
+		multiset.Add(molecule)
+	}
+
+	if !prog.Kind.IsStructural() {
+		atomic.AddInt64(&evaluator.reactions, 1)
+	}
+
+	if evaluator.Trace != nil {
+		evaluator.Trace(Step{Kind: prog.Kind, Reactants: reactants, Products: products})
+	}
+
+	return true, nil
+}
+
+// Creates a molecule from a reaction product, using the values of the program variables in the given state.
+func (evaluator *Evaluator) createProduct(product ast.Product, group *ast.ReactionGroup, state *SimpleState) (Molecule, error) {
+	switch product := product.(type) {
+	case ast.IntegerTermTuple:
+		// An identifier bound to a solution (by an airlock pattern) creates that solution,
+		// and an identifier bound to a reaction (by a reaction pattern) creates that reaction
+		if ident, ok := product.Values[0].(ast.Identifier); ok && product.Dimensions() == 1 {
+			if solution, ok := state.GetSolution(ident); ok {
+				return evaluator.createSubsolution(solution.Copy(), group)
+			}
+			if reaction, ok := state.GetReaction(ident); ok {
+				return reaction, nil
+			}
+		}
+
+		values := make([]int, 0, product.Dimensions())
+		for _, aexp := range product.Values {
+			value, err := aexp.Eval(state)
 			if err != nil {
-				return false, errors.Wrap(err, "error evaluating reaction product")
+				return Molecule{}, errors.Wrap(err, "error evaluating reaction product")
 			}
-			products = append(products, product)
+			values = append(values, value)
+		}
+		return TupleMolecule(ast.CreateIntTuple(values)), nil
+
+	case *ast.SolutionProduct:
+		subsolution := NewMultiset()
+		for _, p := range product.Products {
+			molecule, err := evaluator.createProduct(p, group, state)
+			if err != nil {
+				return Molecule{}, err
+			}
+			subsolution.Add(molecule)
+		}
+		return evaluator.createSubsolution(subsolution, group)
+
+	case *ast.Reaction:
+		// The new reaction molecule captures the variables bound by this reaction
+		return ReactionMolecule(product, state), nil
+
+	case *ast.AirlockProduct:
+		solution, ok := state.GetSolution(product.Solution)
+		if !ok {
+			return Molecule{}, fmt.Errorf("no solution for identifier %v", product.Solution)
 		}
-		multiset.Add(ast.CreateIntTuple(products))
+
+		subsolution := solution.Copy()
+		molecule, err := evaluator.createProduct(product.Product, group, state)
+		if err != nil {
+			return Molecule{}, err
+		}
+		subsolution.Add(molecule)
+		return evaluator.createSubsolution(subsolution, group)
+
+	default:
+		return Molecule{}, fmt.Errorf("unknown product %v", product)
 	}
+}
 
-	return true, nil
+// Creates a subsolution molecule from a new multiset.
+// The new subsolution must be stable before it can react as a whole,
+// so the reactions in the group are performed within it straight away.
+func (evaluator *Evaluator) createSubsolution(subsolution *Multiset, group *ast.ReactionGroup) (Molecule, error) {
+	err := evaluator.evaluateReaction(group, subsolution)
+	if err != nil {
+		return Molecule{}, err
+	}
+	return SolutionMolecule(subsolution), nil
 }
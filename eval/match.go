@@ -0,0 +1,104 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+	"gonum.org/v1/gonum/stat/combin"
+)
+
+// Matches each of the patterns against the molecule at the same index, binding the pattern variables in the state.
+//
+// A subsolution pattern may match the molecules of a subsolution in more than one way, so the test function is
+// called once for every possible way of binding the variables. Matching stops as soon as the test function returns
+// true, leaving the variables bound in the state.
+// Returns true if the molecules were matched and the test function returned true, false otherwise.
+func matchPatterns(patterns []ast.Pattern, molecules []Molecule, state *SimpleState, test func() (bool, error)) (bool, error) {
+	if len(patterns) == 0 {
+		return test()
+	}
+
+	pattern, molecule := patterns[0], molecules[0]
+
+	// Function to match the remaining patterns after this one
+	rest := func() (bool, error) {
+		return matchPatterns(patterns[1:], molecules[1:], state, test)
+	}
+
+	switch pattern := pattern.(type) {
+	case ast.IdentifierTuple:
+		// An identifier tuple only matches an int tuple of the same shape
+		if !molecule.IsTuple() || !ast.ShapeMatches(pattern, molecule.Tuple) {
+			return false, nil
+		}
+
+		for i, ident := range pattern.Values {
+			state.PutVar(ident, molecule.Tuple.Values[i])
+		}
+		return rest()
+
+	case *ast.SolutionPattern:
+		// A subsolution pattern only matches a subsolution with one molecule for each of the inner patterns
+		if !molecule.IsSolution() || molecule.Solution.Cardinality() != len(pattern.Patterns) {
+			return false, nil
+		}
+
+		inner := molecule.Solution.Slice()
+		if len(inner) == 0 {
+			return rest()
+		}
+
+		// Try every ordering of the subsolution molecules against the inner patterns
+		generator := combin.NewPermutationGenerator(len(inner), len(inner))
+		permutation := make([]int, len(inner))
+		ordered := make([]Molecule, len(inner))
+
+		for generator.Next() {
+			generator.Permutation(permutation)
+			for i, index := range permutation {
+				ordered[i] = inner[index]
+			}
+
+			ok, err := matchPatterns(pattern.Patterns, ordered, state, rest)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case *ast.AirlockPattern:
+		// An airlock pattern matches a subsolution containing a molecule which matches the inner pattern
+		if !molecule.IsSolution() {
+			return false, nil
+		}
+
+		// Try each (distinct) molecule in the subsolution against the inner pattern
+		for inner := range molecule.Solution.m {
+			inner := inner
+			ok, err := matchPatterns([]ast.Pattern{pattern.Pattern}, []Molecule{inner}, state, func() (bool, error) {
+				// Bind the rest of the subsolution to the solution identifier
+				remainder := NewMultiset()
+				remainder.MergeFrom(molecule.Solution)
+				remainder.Take(inner)
+				state.PutSolution(pattern.Solution, remainder.Copy())
+
+				return rest()
+			})
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+
+	case *ast.ReactionPattern:
+		// A reaction pattern matches any reaction molecule
+		if !molecule.IsReaction() {
+			return false, nil
+		}
+
+		state.PutReaction(pattern.Identifier, molecule)
+		return rest()
+
+	default:
+		return false, fmt.Errorf("unknown pattern %v", pattern)
+	}
+}
@@ -3,27 +3,135 @@ package eval
 import (
 	"fmt"
 	"github.com/howden/cham/ast"
+	"sort"
+	"strings"
 )
 
+// A molecule is a single element of a multiset (solution).
+// It is either an int tuple, a nested subsolution or a reaction.
+//
+// Subsolutions and reactions are compared by identity, so two subsolutions
+// with the same contents are still considered to be distinct molecules.
+type Molecule struct {
+	Tuple    ast.IntTuple
+	Solution *Multiset
+	Reaction *ast.Reaction
+
+	// The variables that were bound when a reaction molecule was created (as a reaction product).
+	// These can be referenced by the reaction, in the same way as a closure. Can be nil.
+	Bindings *SimpleState
+}
+
+// Creates a molecule holding an int tuple
+func TupleMolecule(tuple ast.IntTuple) Molecule {
+	return Molecule{Tuple: tuple}
+}
+
+// Creates a molecule holding a subsolution
+func SolutionMolecule(solution *Multiset) Molecule {
+	return Molecule{Solution: solution}
+}
+
+// Creates a molecule holding a reaction, along with the variables it has captured (which can be nil)
+func ReactionMolecule(reaction *ast.Reaction, bindings *SimpleState) Molecule {
+	return Molecule{Reaction: reaction, Bindings: bindings}
+}
+
+// Returns whether the molecule holds a subsolution
+func (molecule Molecule) IsSolution() bool {
+	return molecule.Solution != nil
+}
+
+// Returns whether the molecule holds a reaction
+func (molecule Molecule) IsReaction() bool {
+	return molecule.Reaction != nil
+}
+
+// Returns whether the molecule holds an int tuple
+func (molecule Molecule) IsTuple() bool {
+	return !molecule.IsSolution() && !molecule.IsReaction()
+}
+
+func (molecule Molecule) String() string {
+	if molecule.IsSolution() {
+		var values []string
+		for _, m := range molecule.Solution.Slice() {
+			values = append(values, m.String())
+		}
+		return fmt.Sprintf("{%s}", strings.Join(values, " "))
+	}
+	if molecule.IsReaction() {
+		if molecule.Reaction.Once {
+			return "(once reaction)"
+		}
+		return "(reaction)"
+	}
+	return molecule.Tuple.String()
+}
+
+var errTooManyMolecules = fmt.Errorf("solution contains more than the maximum of %d molecules", ast.MaxCardinality)
+
 type Multiset struct {
-	m    map[ast.IntTuple]int
+	m    map[Molecule]int
 	card int
 }
 
 func NewMultiset() *Multiset {
-	return &Multiset{make(map[ast.IntTuple]int), 0}
+	return &Multiset{make(map[Molecule]int), 0}
 }
 
-func (set *Multiset) Add(i ast.IntTuple) {
+func (set *Multiset) Add(i Molecule) {
 	set.m[i]++
 	set.card++
 }
 
-func (set *Multiset) AddAll(arr []ast.IntTuple) {
-	for _, i := range arr {
-		set.m[i]++
+// Adds the contents of a solution literal to the multiset, including any nested subsolutions.
+// The resolve function is used to find the contents of any named solutions the literal refers to.
+func (set *Multiset) AddAll(solution *ast.Solution, resolve func(ident ast.Identifier) (*Multiset, error)) error {
+	for _, i := range solution.Tuples {
+		set.m[TupleMolecule(i)]++
+	}
+	set.card += len(solution.Tuples)
+
+	for _, g := range solution.Generators {
+		// the count is compared to the remaining space, so that adding it can't overflow the cardinality
+		exceeded := false
+		g.Generate(func(tuple ast.IntTuple, count int) {
+			if exceeded || count > ast.MaxCardinality-set.card {
+				exceeded = true
+				return
+			}
+			set.m[TupleMolecule(tuple)] += count
+			set.card += count
+		})
+		if exceeded {
+			return errTooManyMolecules
+		}
+	}
+
+	for _, r := range solution.Reactions {
+		set.Add(ReactionMolecule(r, nil))
+	}
+
+	for _, s := range solution.Subsolutions {
+		sub := NewMultiset()
+		if err := sub.AddAll(s, resolve); err != nil {
+			return err
+		}
+		set.Add(SolutionMolecule(sub))
+	}
+
+	for _, ident := range solution.References {
+		named, err := resolve(ident)
+		if err != nil {
+			return err
+		}
+		if named.card > ast.MaxCardinality-set.card {
+			return errTooManyMolecules
+		}
+		set.MergeFrom(named.Copy())
 	}
-	set.card += len(arr)
+	return nil
 }
 
 func (set *Multiset) MergeFrom(other *Multiset) {
@@ -33,7 +141,7 @@ func (set *Multiset) MergeFrom(other *Multiset) {
 	set.card += other.card
 }
 
-func (set *Multiset) Take(i ast.IntTuple) {
+func (set *Multiset) Take(i Molecule) {
 	existing, ok := set.m[i]
 	if !ok {
 		panic(fmt.Sprintf("cannot take %v from multiset", i))
@@ -48,7 +156,7 @@ func (set *Multiset) Take(i ast.IntTuple) {
 }
 
 func (set *Multiset) Clear() {
-	set.m = make(map[ast.IntTuple]int)
+	set.m = make(map[Molecule]int)
 	set.card = 0
 }
 
@@ -56,8 +164,8 @@ func (set *Multiset) Cardinality() int {
 	return set.card
 }
 
-func (set *Multiset) Slice() []ast.IntTuple {
-	res := make([]ast.IntTuple, 0, set.card)
+func (set *Multiset) Slice() []Molecule {
+	res := make([]Molecule, 0, set.card)
 	for val, count := range set.m {
 		for i := 0; i < count; i++ {
 			res = append(res, val)
@@ -66,6 +174,44 @@ func (set *Multiset) Slice() []ast.IntTuple {
 	return res
 }
 
+// Creates a copy of the multiset, including copies of any subsolutions
+func (set *Multiset) Copy() *Multiset {
+	res := NewMultiset()
+	for val, count := range set.m {
+		if val.IsSolution() {
+			for i := 0; i < count; i++ {
+				res.Add(SolutionMolecule(val.Solution.Copy()))
+			}
+		} else {
+			res.m[val] = count
+			res.card += count
+		}
+	}
+	return res
+}
+
+// Returns the subsolutions contained (directly) within the multiset
+func (set *Multiset) Subsolutions() []*Multiset {
+	var res []*Multiset
+	for val := range set.m {
+		if val.IsSolution() {
+			res = append(res, val.Solution)
+		}
+	}
+	return res
+}
+
+// Returns the reaction molecules contained (directly) within the multiset
+func (set *Multiset) Reactions() []Molecule {
+	var res []Molecule
+	for val := range set.m {
+		if val.IsReaction() {
+			res = append(res, val)
+		}
+	}
+	return res
+}
+
 // Partitions the multiset into multiple other multisets of the given size
 func (set *Multiset) Partition(size int) []*Multiset {
 	if size <= 0 {
@@ -104,3 +250,52 @@ func (set *Multiset) Partition(size int) []*Multiset {
 func (set *Multiset) String() string {
 	return fmt.Sprint(set.Slice())
 }
+
+// Returns the source code of a solution literal which contains the same molecules as the multiset.
+// The molecules are sorted, so the same multiset always gives the same source code.
+//
+// A reaction molecule is printed with the ints it has captured substituted into it. It can't be printed if it has
+// captured a solution or another reaction molecule, as these can't be written in a reaction.
+func (set *Multiset) Source() (string, error) {
+	molecules := make([]string, 0, len(set.m))
+	for molecule, count := range set.m {
+		src, err := molecule.Source()
+		if err != nil {
+			return "", err
+		}
+
+		if molecule.IsTuple() && count > 1 {
+			molecules = append(molecules, fmt.Sprintf("%s ^ %d", src, count))
+			continue
+		}
+		for i := 0; i < count; i++ {
+			molecules = append(molecules, src)
+		}
+	}
+
+	sort.Strings(molecules)
+	return fmt.Sprintf("{%s}", strings.Join(molecules, ", ")), nil
+}
+
+// Returns the source code of the molecule, as it would be written in a solution literal
+func (molecule Molecule) Source() (string, error) {
+	if molecule.IsSolution() {
+		return molecule.Solution.Source()
+	}
+	if molecule.IsReaction() {
+		reaction := molecule.Reaction
+		if bindings := molecule.Bindings; bindings != nil {
+			if len(bindings.solutions) > 0 || len(bindings.reactions) > 0 {
+				return "", fmt.Errorf("a reaction molecule which has captured a solution or reaction cannot be saved")
+			}
+
+			s := make(ast.Substitution, len(bindings.m))
+			for ident, v := range bindings.m {
+				s[ident] = ast.Number(v)
+			}
+			reaction = reaction.Substitute(s)
+		}
+		return ast.ReactionMoleculeSource(reaction), nil
+	}
+	return molecule.Tuple.Source(), nil
+}
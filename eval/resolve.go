@@ -0,0 +1,153 @@
+package eval
+
+import (
+	"github.com/howden/cham/ast"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Resolves the references to defined reactions within the stages, using the definitions in the store.
+//
+// The path holds the identifiers of the definitions which are currently being resolved, so that a definition which
+// (directly or indirectly) refers to itself can be detected.
+func (evaluator *Evaluator) resolveStages(stages []ast.Stage, path []ast.Identifier) ([]ast.Stage, error) {
+	res := make([]ast.Stage, 0, len(stages))
+	for _, stage := range stages {
+		switch stage := stage.(type) {
+		case *ast.Reaction:
+			res = append(res, stage)
+		case *ast.ReactionGroup:
+			group, err := evaluator.resolveGroup(stage, path)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, group)
+		case *ast.ReactionReference:
+			resolved, err := evaluator.resolveReference(stage, path)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, resolved...)
+		case *ast.Loop:
+			resolved, err := evaluator.resolveStages(stage.Stages, path)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, &ast.Loop{Stages: resolved, Limit: stage.Limit})
+		case *ast.Branch:
+			branch := &ast.Branch{Predicate: stage.Predicate}
+			for _, stages := range stage.Branches {
+				resolved, err := evaluator.resolveStages(stages, path)
+				if err != nil {
+					return nil, err
+				}
+				branch.Branches = append(branch.Branches, resolved)
+			}
+			res = append(res, branch)
+		default:
+			return nil, errors.Errorf("unknown stage %v", stage)
+		}
+	}
+	return res, nil
+}
+
+// Resolves a reference to a defined reaction, substituting the arguments into the definition
+func (evaluator *Evaluator) resolveReference(ref *ast.ReactionReference, path []ast.Identifier) ([]ast.Stage, error) {
+	name := ref.Identifier.Name()
+
+	for i, ident := range path {
+		if ident == ref.Identifier {
+			var cycle []string
+			for _, ident := range path[i:] {
+				cycle = append(cycle, ":"+ident.Name())
+			}
+			cycle = append(cycle, ":"+name)
+			return nil, errors.Errorf("reaction :%s refers to itself (%s)", name, strings.Join(cycle, " -> "))
+		}
+	}
+
+	if evaluator.Store == nil {
+		return nil, errors.Errorf("undefined reaction :%s", name)
+	}
+	def, err := evaluator.Store.GetReference(ref)
+	if err != nil {
+		return nil, errors.Errorf("undefined reaction :%s", name)
+	}
+
+	if len(ref.Arguments) != len(def.Parameters) {
+		return nil, errors.Errorf("reaction :%s expects %d argument(s) but got %d", name, len(def.Parameters), len(ref.Arguments))
+	}
+
+	stages := def.Reactions
+	if len(ref.Arguments) > 0 {
+		substitution := make(ast.Substitution, len(ref.Arguments))
+		for i, param := range def.Parameters {
+			substitution[param] = ref.Arguments[i]
+		}
+		stages = ast.SubstituteStages(stages, substitution)
+	}
+
+	return evaluator.resolveStages(stages, append(path[:len(path):len(path)], ref.Identifier))
+}
+
+// Resolves the references within a group of reactions (and its fallback groups), returning a new group
+func (evaluator *Evaluator) resolveGroup(group *ast.ReactionGroup, path []ast.Identifier) (*ast.ReactionGroup, error) {
+	if group == nil {
+		return nil, nil
+	}
+
+	fallback, err := evaluator.resolveGroup(group.Fallback, path)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ast.ReactionGroup{Reactions: append([]*ast.Reaction{}, group.Reactions...), Fallback: fallback}
+	for _, ref := range group.References {
+		stages, err := evaluator.resolveReference(ref, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(stages) != 1 {
+			return nil, errors.Errorf("reaction :%s is a chain of reactions, so cannot be composed", ref.Identifier.Name())
+		}
+
+		// A reference to a prioritised group can only be used on its own, in which case it
+		// takes the place of this group in the priority chain
+		if resolved, ok := stages[0].(*ast.ReactionGroup); ok && resolved.Fallback != nil &&
+			len(group.Reactions) == 0 && len(group.References) == 1 {
+			res = resolved.Copy()
+			last := res
+			for last.Fallback != nil {
+				last = last.Fallback
+			}
+			last.Fallback = fallback
+			return res, nil
+		}
+
+		if err := res.Add(stages[0]); err != nil {
+			return nil, errors.Wrapf(err, "error composing reaction :%s", ref.Identifier.Name())
+		}
+	}
+	return res, nil
+}
+
+// Resolves a reference to a named solution, using the solutions in the store
+func (evaluator *Evaluator) resolveSolution(ident ast.Identifier) (*Multiset, error) {
+	if evaluator.Store == nil {
+		return nil, errors.Errorf("undefined solution $%s", ident.Name())
+	}
+	solution, err := evaluator.Store.GetSolution(ident)
+	if err != nil {
+		return nil, errors.Errorf("undefined solution $%s", ident.Name())
+	}
+	return solution, nil
+}
+
+// Resolves a call to a user-defined function, using the functions in the store
+func (evaluator *Evaluator) resolveFunction(ident ast.Identifier) (*ast.FunctionDefinition, error) {
+	if evaluator.Store == nil {
+		return nil, errors.Errorf("undefined function %s", ident.Name())
+	}
+	return evaluator.Store.GetFunction(ident)
+}
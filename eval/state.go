@@ -7,12 +7,27 @@ import (
 
 type SimpleState struct {
 	m map[ast.Identifier]int
+
+	// Holds the solutions bound to identifiers by airlock patterns
+	solutions map[ast.Identifier]*Multiset
+
+	// Holds the reaction molecules bound to identifiers by reaction patterns
+	reactions map[ast.Identifier]Molecule
+
+	// Holds the errors from evaluating local variables (in a where clause). These are only reported if the variable
+	// is used, so a local which can't be evaluated for some reactants doesn't stop the guard from rejecting them.
+	errs map[ast.Identifier]error
+
+	// Used to look up the user-defined functions called by a reaction. Can be nil, if there are no functions.
+	functions func(ident ast.Identifier) (*ast.FunctionDefinition, error)
 }
 
 func (s *SimpleState) GetVar(ident ast.Identifier) (int, error) {
 	v, ok := s.m[ident]
 	if ok {
 		return v, nil
+	} else if err, ok := s.errs[ident]; ok {
+		return 0, err
 	} else {
 		return 0, fmt.Errorf("no value for identifier %v", ident)
 	}
@@ -20,12 +35,69 @@ func (s *SimpleState) GetVar(ident ast.Identifier) (int, error) {
 
 func (s *SimpleState) PutVar(ident ast.Identifier, v int) {
 	s.m[ident] = v
+	delete(s.errs, ident)
+}
+
+// Records that the variable has no value because evaluating it failed. The error is returned when the variable is used.
+func (s *SimpleState) PutVarError(ident ast.Identifier, err error) {
+	delete(s.m, ident)
+	s.errs[ident] = err
 }
 
 func (s *SimpleState) RemoveVar(ident ast.Identifier) {
 	delete(s.m, ident)
+	delete(s.errs, ident)
+}
+
+func (s *SimpleState) GetSolution(ident ast.Identifier) (*Multiset, bool) {
+	v, ok := s.solutions[ident]
+	return v, ok
+}
+
+func (s *SimpleState) PutSolution(ident ast.Identifier, v *Multiset) {
+	s.solutions[ident] = v
+}
+
+func (s *SimpleState) GetReaction(ident ast.Identifier) (Molecule, bool) {
+	v, ok := s.reactions[ident]
+	return v, ok
+}
+
+func (s *SimpleState) PutReaction(ident ast.Identifier, v Molecule) {
+	s.reactions[ident] = v
+}
+
+func (s *SimpleState) GetFunction(ident ast.Identifier) (*ast.FunctionDefinition, error) {
+	if s.functions == nil {
+		return nil, fmt.Errorf("undefined function %s", ident.Name())
+	}
+	return s.functions(ident)
+}
+
+// Creates a copy of the state
+func (s *SimpleState) Copy() *SimpleState {
+	res := NewState()
+	for k, v := range s.m {
+		res.m[k] = v
+	}
+	for k, v := range s.errs {
+		res.errs[k] = v
+	}
+	for k, v := range s.solutions {
+		res.solutions[k] = v
+	}
+	for k, v := range s.reactions {
+		res.reactions[k] = v
+	}
+	res.functions = s.functions
+	return res
 }
 
 func NewState() *SimpleState {
-	return &SimpleState{make(map[ast.Identifier]int)}
+	return &SimpleState{
+		m:         make(map[ast.Identifier]int),
+		errs:      make(map[ast.Identifier]error),
+		solutions: make(map[ast.Identifier]*Multiset),
+		reactions: make(map[ast.Identifier]Molecule),
+	}
 }
@@ -3,14 +3,57 @@ package eval
 import (
 	"fmt"
 	"github.com/howden/cham/ast"
+	"strings"
 )
 
+// Holds the reactions, functions and solutions which have been defined (e.g. in the REPL)
 type ReactionStore struct {
-	m map[ast.Identifier][]*ast.Reaction
+	m         map[ast.Identifier]*ast.ReactionPointer
+	functions map[ast.Identifier]*ast.FunctionDefinition
+	solutions map[ast.Identifier]*Multiset
+
+	// The modules which have been imported, keyed by their absolute path
+	modules map[string]*Module
+}
+
+// A module (file) which has been imported into the store
+type Module struct {
+	Path      string
+	Namespace string
+
+	// All of the definitions made by the module, including those of the modules it imports
+	Definitions []ast.Definition
+}
+
+// The namespace of the standard library.
+// A reaction or function which hasn't been defined is looked up in the standard library, so that its definitions can be
+// used without the namespace, and shadowed by user definitions.
+const StdNamespace = "std"
+
+// Returns the identifier of the standard library definition with the same name
+func stdIdent(ident ast.Identifier) ast.Identifier {
+	return ast.Ident(StdNamespace + "." + ident.Name())
 }
 
-func (s *ReactionStore) Get(ident ast.Identifier) ([]*ast.Reaction, error) {
+// Returns whether the definition with the given identifier is part of the standard library
+func IsStd(ident ast.Identifier) bool {
+	return strings.HasPrefix(ident.Name(), StdNamespace+".")
+}
+
+// Returns whether the standard library reaction with the given identifier is shadowed by a user definition
+func (s *ReactionStore) IsShadowed(ident ast.Identifier) bool {
+	if !IsStd(ident) {
+		return false
+	}
+	_, ok := s.m[ast.Ident(strings.TrimPrefix(ident.Name(), StdNamespace+"."))]
+	return ok
+}
+
+func (s *ReactionStore) Get(ident ast.Identifier) (*ast.ReactionPointer, error) {
 	v, ok := s.m[ident]
+	if !ok {
+		v, ok = s.m[stdIdent(ident)]
+	}
 	if ok {
 		return v, nil
 	} else {
@@ -18,8 +61,30 @@ func (s *ReactionStore) Get(ident ast.Identifier) ([]*ast.Reaction, error) {
 	}
 }
 
+// Returns the definition of the reaction which the reference refers to.
+// A reference made within a module is looked up in the module first, and then by the name it was written with.
+func (s *ReactionStore) GetReference(ref *ast.ReactionReference) (*ast.ReactionPointer, error) {
+	def, err := s.Get(ref.Identifier)
+	if err != nil && ref.Fallback.Name() != "" {
+		if fallback, fallbackErr := s.Get(ref.Fallback); fallbackErr == nil {
+			return fallback, nil
+		}
+	}
+	return def, err
+}
+
 func (s *ReactionStore) Put(def *ast.ReactionPointer) {
-	s.m[def.Identifier] = def.Reactions
+	s.m[def.Identifier] = def
+}
+
+// Stores a reaction or function definition
+func (s *ReactionStore) Define(def ast.Definition) {
+	switch def := def.(type) {
+	case *ast.ReactionPointer:
+		s.Put(def)
+	case *ast.FunctionDefinition:
+		s.PutFunction(def)
+	}
 }
 
 func (s *ReactionStore) Delete(ident ast.Identifier) {
@@ -28,15 +93,83 @@ func (s *ReactionStore) Delete(ident ast.Identifier) {
 
 func (s *ReactionStore) Slice() []*ast.ReactionPointer {
 	res := make([]*ast.ReactionPointer, 0, len(s.m))
-	for ident, reactions := range s.m {
-		res = append(res, &ast.ReactionPointer{
-			Identifier: ident,
-			Reactions:  reactions,
-		})
+	for _, def := range s.m {
+		res = append(res, def)
+	}
+	return res
+}
+
+func (s *ReactionStore) GetFunction(ident ast.Identifier) (*ast.FunctionDefinition, error) {
+	v, ok := s.functions[ident]
+	if !ok {
+		v, ok = s.functions[stdIdent(ident)]
+	}
+	if ok {
+		return v, nil
+	} else {
+		return nil, fmt.Errorf("undefined function %s", ident.Name())
+	}
+}
+
+func (s *ReactionStore) PutFunction(def *ast.FunctionDefinition) {
+	s.functions[def.Identifier] = def
+}
+
+// Returns all of the stored functions
+func (s *ReactionStore) Functions() []*ast.FunctionDefinition {
+	res := make([]*ast.FunctionDefinition, 0, len(s.functions))
+	for _, def := range s.functions {
+		res = append(res, def)
+	}
+	return res
+}
+
+func (s *ReactionStore) GetSolution(ident ast.Identifier) (*Multiset, error) {
+	v, ok := s.solutions[ident]
+	if ok {
+		return v, nil
+	} else {
+		return nil, fmt.Errorf("no solution for identifier %v", ident)
+	}
+}
+
+func (s *ReactionStore) PutSolution(ident ast.Identifier, solution *Multiset) {
+	s.solutions[ident] = solution
+}
+
+// Returns the names of all of the stored solutions
+func (s *ReactionStore) SolutionNames() []ast.Identifier {
+	res := make([]ast.Identifier, 0, len(s.solutions))
+	for ident := range s.solutions {
+		res = append(res, ident)
+	}
+	return res
+}
+
+// Returns the module imported from the given (absolute) path
+func (s *ReactionStore) GetModule(path string) (*Module, bool) {
+	module, ok := s.modules[path]
+	return module, ok
+}
+
+func (s *ReactionStore) PutModule(module *Module) {
+	s.modules[module.Path] = module
+}
+
+// Returns all of the imported modules
+func (s *ReactionStore) Modules() []*Module {
+	res := make([]*Module, 0, len(s.modules))
+	for _, module := range s.modules {
+		res = append(res, module)
 	}
 	return res
 }
 
 func NewReactionStore() *ReactionStore {
-	return &ReactionStore{make(map[ast.Identifier][]*ast.Reaction)}
+	return &ReactionStore{
+		make(map[ast.Identifier]*ast.ReactionPointer),
+		make(map[ast.Identifier]*ast.FunctionDefinition),
+		make(map[ast.Identifier]*Multiset),
+		make(map[string]*Module),
+	}
 }
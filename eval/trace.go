@@ -0,0 +1,18 @@
+package eval
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+)
+
+// A single step that took place during evaluation: a rule consuming
+// some reactants from the solution, and replacing them with products.
+type Step struct {
+	Kind      ast.ReactionKind
+	Reactants []Molecule
+	Products  []Molecule
+}
+
+func (step Step) String() string {
+	return fmt.Sprintf("%-8s %v -> %v", step.Kind, step.Reactants, step.Products)
+}
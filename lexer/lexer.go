@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/howden/cham/token"
 	"io"
+	"strconv"
 	"strings"
 	"text/scanner"
 	"unicode"
@@ -11,6 +12,24 @@ import (
 
 type Lexer struct {
 	scanner *scanner.Scanner
+
+	// The number of unclosed brackets, and the type of the last token produced.
+	// These are used to decide whether a line break ends the current statement.
+	depth int
+	last  token.TokenType
+
+	// The last error reported by the scanner (e.g. for an unterminated string)
+	err error
+
+	// The comments which have been skipped over, in the order they appear
+	comments []Comment
+}
+
+// A comment in the source code, which is skipped by the lexer
+type Comment struct {
+	Text   string
+	Line   int
+	Column int
 }
 
 // Creates a new Lexer from an input string
@@ -23,18 +42,27 @@ func FromReader(input io.Reader, fileName string) *Lexer {
 	var s scanner.Scanner
 	s.Init(input)
 	s.Filename = fileName
-	s.Mode = scanner.ScanIdents | scanner.ScanFloats | /*scanner.ScanChars | scanner.ScanStrings |*/ scanner.ScanComments | scanner.SkipComments
+	s.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanStrings | /*scanner.ScanChars |*/ scanner.ScanComments
+	// line breaks are significant, as they can end a statement
+	s.Whitespace = scanner.GoWhitespace &^ (1 << '\n')
 	s.IsIdentRune = func(ch rune, i int) bool {
-		return (unicode.IsLetter(ch) && unicode.IsLower(ch)) || ch == '_' /*|| unicode.IsDigit(ch) && i > 0*/
+		// dots separate the parts of a namespaced name, e.g. math.max
+		return unicode.IsLetter(ch) || ch == '_' || i > 0 && (unicode.IsDigit(ch) || ch == '.')
 	}
 
-	return &Lexer{&s}
+	lexer := &Lexer{scanner: &s}
+	s.Error = func(s *scanner.Scanner, msg string) {
+		lexer.err = fmt.Errorf("%s at %s", msg, s.Pos())
+	}
+	return lexer
 }
 
 // "Simple" tokens with a direct, non-ambiguous mapping from single character to token
 var simpleTokens = map[rune]token.TokenType{
 	'|': token.ReactionChain,
 	':': token.ReactionDef,
+	'$': token.SolutionRef,
+	'=': token.Assign,
 	'!': token.Not,
 	'(': token.OpenBracket,
 	')': token.CloseBracket,
@@ -48,37 +76,158 @@ var simpleTokens = map[rune]token.TokenType{
 	'/': token.Divide,
 	'%': token.Modulo,
 	',': token.Comma,
+	'^': token.Caret,
+	';': token.Semicolon,
+	'⇀': token.HeatingOp,
+	'↽': token.CoolingOp,
+	'⇌': token.ReversibleOp,
+	'◁': token.AirlockOp,
 }
 
-// Produces the next token from the lexer
+// Checks that each part of a (possibly namespaced) identifier is valid - non-empty, and not starting with a digit
+func validateIdent(ident string) error {
+	for _, part := range strings.Split(ident, ".") {
+		if part == "" || unicode.IsDigit([]rune(part)[0]) {
+			return fmt.Errorf("invalid identifier '%s'", ident)
+		}
+	}
+	return nil
+}
+
+// Produces the next token from the lexer.
+// A line break produces a semicolon token, which ends the current statement, unless the statement continues on the
+// next line because the line ends with '|' or has unclosed brackets. A blank line always ends the statement.
 func (lexer *Lexer) NextToken() token.Token {
 	s := lexer.scanner
 	tok := s.Scan()
 
+	// the end of the line is used as the position of a semicolon produced by a line break
+	newlines, end := 0, s.Position
+	for tok == '\n' || tok == scanner.Comment {
+		if tok == scanner.Comment {
+			// a line containing a comment isn't blank
+			newlines = 0
+			lexer.comments = append(lexer.comments, Comment{s.TokenText(), s.Position.Line, s.Position.Column})
+		} else if newlines++; newlines == 1 {
+			end = s.Position
+		}
+
+		if tok == '\n' && (newlines == 2 || !lexer.Continues()) {
+			// the brackets left unclosed by a statement ended with a blank line don't continue the following statements
+			if newlines == 2 {
+				lexer.depth = 0
+			}
+			if lexer.last != token.EOF && lexer.last != token.Semicolon {
+				return lexer.produce(token.Semicolon.New(), end)
+			}
+		}
+		tok = s.Scan()
+	}
+
+	// the position must be saved before the rest of a multi-character token is scanned
+	pos := s.Position
+	next := lexer.scanToken(tok)
+	if lexer.err != nil {
+		next, lexer.err = token.Error(lexer.err), nil
+	}
+	return lexer.produce(next, pos)
+}
+
+// Tests whether the current statement continues onto the next line, because the last line ended with '|' or there
+// are unclosed brackets
+func (lexer *Lexer) Continues() bool {
+	return lexer.depth > 0 || lexer.last == token.ReactionChain
+}
+
+// Records a token produced by the lexer, and the position where it starts
+func (lexer *Lexer) produce(tok token.Token, pos scanner.Position) token.Token {
+	tok.Line, tok.Column = pos.Line, pos.Column
+
+	switch tok.Type {
+	case token.OpenBracket, token.OpenCurlyBracket, token.OpenSquareBracket:
+		lexer.depth++
+	case token.CloseBracket, token.CloseCurlyBracket, token.CloseSquareBracket:
+		if lexer.depth > 0 {
+			lexer.depth--
+		}
+	}
+	// the end of the input is not recorded, so it can still be checked whether the last statement was complete
+	if tok.Type != token.EOF {
+		lexer.last = tok.Type
+	}
+	return tok
+}
+
+// Produces a token from the given character (or token class) returned by the scanner
+func (lexer *Lexer) scanToken(tok rune) token.Token {
+	s := lexer.scanner
+
 	if tok == scanner.EOF {
 		return token.EOF.New()
 	} else if tok == scanner.Ident {
-		if lexer.scanner.TokenText() == "if" {
-			return token.If.New()
+		if keyword, ok := token.Keywords[s.TokenText()]; ok {
+			return keyword.New()
+		}
+		if err := validateIdent(s.TokenText()); err != nil {
+			return token.Error(fmt.Errorf("%v at %s", err, s.Pos()))
 		}
 		return token.Ident.WithLiteral(s.TokenText())
 	} else if tok == scanner.Int {
 		return token.Number.WithLiteral(s.TokenText())
+	} else if tok == scanner.String {
+		str, err := strconv.Unquote(s.TokenText())
+		if err != nil {
+			return token.Error(fmt.Errorf("invalid string %s at %s", s.TokenText(), s.Pos()))
+		}
+		return token.String.WithLiteral(str)
 	} else if tok == '=' && s.Peek() == '>' {
 		s.Scan()
 		return token.ReactionOp.New()
+	} else if tok == '~' {
+		if s.Peek() == '>' {
+			s.Scan()
+			return token.HeatingOp.New()
+		}
+		return token.BitwiseNot.New()
 	} else if tok == '<' {
 		if s.Peek() == '=' {
 			s.Scan()
 			return token.LessThanOrEqual.New()
 		}
+		if s.Peek() == '|' {
+			s.Scan()
+			return token.AirlockOp.New()
+		}
+		if s.Peek() == '<' {
+			s.Scan()
+			return token.LeftShift.New()
+		}
+		// <~ is always read as the cooling operator. Within an expression the parser reads it as < followed by ~
+		if s.Peek() == '~' {
+			s.Scan()
+			if s.Peek() == '>' {
+				s.Scan()
+				return token.ReversibleOp.New()
+			}
+			return token.CoolingOp.New()
+		}
 		return token.LessThan.New()
 	} else if tok == '>' {
 		if s.Peek() == '=' {
 			s.Scan()
 			return token.GreaterThanOrEqual.New()
 		}
+		if s.Peek() == '>' {
+			s.Scan()
+			return token.RightShift.New()
+		}
 		return token.GreaterThan.New()
+	} else if tok == '*' && s.Peek() == '*' {
+		s.Scan()
+		return token.Power.New()
+	} else if tok == '.' && s.Peek() == '.' {
+		s.Scan()
+		return token.Range.New()
 	} else if tok == '=' && s.Peek() == '=' {
 		s.Scan()
 		return token.Equal.New()
@@ -88,9 +237,12 @@ func (lexer *Lexer) NextToken() token.Token {
 	} else if tok == '|' && s.Peek() == '|' {
 		s.Scan()
 		return token.Or.New()
-	} else if tok == '&' && s.Peek() == '&' {
-		s.Scan()
-		return token.And.New()
+	} else if tok == '&' {
+		if s.Peek() == '&' {
+			s.Scan()
+			return token.And.New()
+		}
+		return token.BitwiseAnd.New()
 	} else if desc, found := simpleTokens[tok]; found {
 		return desc.New()
 	} else {
@@ -98,6 +250,11 @@ func (lexer *Lexer) NextToken() token.Token {
 	}
 }
 
+// Returns the comments which have been skipped over so far
+func (lexer *Lexer) Comments() []Comment {
+	return lexer.comments
+}
+
 // Returns the current position of the scanner
 func (lexer *Lexer) Pos() scanner.Position {
 	return lexer.scanner.Pos()
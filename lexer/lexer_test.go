@@ -1,6 +1,8 @@
 package lexer
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -82,6 +84,122 @@ func TestLex(t *testing.T) {
 				"closeCurlyBracket",
 			},
 		},
+		{
+			"[p,q] <~> p, q ~> x <| s <~ y",
+			[]string{
+				"openSquareBracket",
+				"ident(p)",
+				"comma",
+				"ident(q)",
+				"closeSquareBracket",
+				"reversibleOp",
+				"ident(p)",
+				"comma",
+				"ident(q)",
+				"heatingOp",
+				"ident(x)",
+				"airlockOp",
+				"ident(s)",
+				"coolingOp",
+				"ident(y)",
+			},
+		},
+		{
+			"(once x => x)",
+			[]string{
+				"openBracket",
+				"once",
+				"ident(x)",
+				"reactionOp",
+				"ident(x)",
+				"closeBracket",
+			},
+		},
+		{
+			"x & ~y | z ^ 1 << 2 >> 3 && x <~ y ~> z",
+			[]string{
+				"ident(x)",
+				"bitwiseAnd",
+				"bitwiseNot",
+				"ident(y)",
+				"reactionChain",
+				"ident(z)",
+				"caret",
+				"number(1)",
+				"leftShift",
+				"number(2)",
+				"rightShift",
+				"number(3)",
+				"and",
+				"ident(x)",
+				"coolingOp",
+				"ident(y)",
+				"heatingOp",
+				"ident(z)",
+			},
+		},
+		{
+			"-x ** 2 * 3",
+			[]string{
+				"subtract",
+				"ident(x)",
+				"power",
+				"number(2)",
+				"multiply",
+				"number(3)",
+			},
+		},
+		{
+			"{2..10 step 2, 0^5}",
+			[]string{
+				"openCurlyBracket",
+				"number(2)",
+				"range",
+				"number(10)",
+				"ident(step)",
+				"number(2)",
+				"comma",
+				"number(0)",
+				"caret",
+				"number(5)",
+				"closeCurlyBracket",
+			},
+		},
+		{
+			"x ⇀ y ↽ z ⇌ x ◁ s",
+			[]string{
+				"ident(x)",
+				"heatingOp",
+				"ident(y)",
+				"coolingOp",
+				"ident(z)",
+				"reversibleOp",
+				"ident(x)",
+				"airlockOp",
+				"ident(s)",
+			},
+		},
+		{
+			`import "lib/sorting.cham" as sort`,
+			[]string{
+				"import",
+				"string(lib/sorting.cham)",
+				"as",
+				"ident(sort)",
+			},
+		},
+		{
+			"x1, xPrime, ünï => math.max2",
+			[]string{
+				"ident(x1)",
+				"comma",
+				"ident(xPrime)",
+				"comma",
+				"ident(ünï)",
+				"reactionOp",
+				"ident(math.max2)",
+			},
+		},
 	}
 
 	for testNo, test := range tests {
@@ -111,7 +229,7 @@ func TestLex(t *testing.T) {
 }
 
 func TestLexError(t *testing.T) {
-	src := "x, y => x if (x > 100) & y < 2"
+	src := "x, y => x if (x > 100) @ y < 2"
 	_, err := FromString(src).RemainingTokens()
 
 	if err == nil {
@@ -119,9 +237,122 @@ func TestLexError(t *testing.T) {
 		return
 	}
 
-	expectedError := "unknown token '&' at repl:1:25"
+	expectedError := "unknown token '@' type \"@\" at repl:1:25"
 
 	if err.Error() != expectedError {
 		t.Errorf("incorrect error. expected=%q, got=%q", expectedError, err.Error())
 	}
 }
+
+func TestLexInvalidIdentifiers(t *testing.T) {
+	tests := []string{"math.", "math..max", "math.2max", `"unterminated`}
+
+	for _, src := range tests {
+		if _, err := FromString(src).RemainingTokens(); err == nil {
+			t.Errorf("expected error lexing %q", src)
+		}
+	}
+}
+
+func TestLexStatements(t *testing.T) {
+	tests := []struct {
+		src            string
+		expectedTokens []string
+	}{
+		// line breaks and semicolons end statements
+		{"a\nb;c", []string{"ident(a)", "semicolon", "ident(b)", "semicolon", "ident(c)"}},
+		// line breaks at the start and end of the input, and repeated line breaks, are ignored
+		{"\n\na\n\n\nb\n", []string{"ident(a)", "semicolon", "ident(b)", "semicolon"}},
+		// a trailing reaction chain operator continues the statement
+		{"a |\nb", []string{"ident(a)", "reactionChain", "ident(b)"}},
+		// as do unclosed brackets
+		{"{1,\n2}\nc", []string{"openCurlyBracket", "number(1)", "comma", "number(2)", "closeCurlyBracket", "semicolon", "ident(c)"}},
+		// but a blank line always ends the statement
+		{"a |\n\nb", []string{"ident(a)", "reactionChain", "semicolon", "ident(b)"}},
+		// even one with unclosed brackets, which then don't continue the following statements
+		{"{1,\n\na\nb", []string{"openCurlyBracket", "number(1)", "comma", "semicolon", "ident(a)", "semicolon", "ident(b)"}},
+		{"(a;\n\nb\nc", []string{"openBracket", "ident(a)", "semicolon", "ident(b)", "semicolon", "ident(c)"}},
+		// a line containing a comment isn't blank
+		{"a |\n// comment\nb // comment\nc", []string{"ident(a)", "reactionChain", "ident(b)", "semicolon", "ident(c)"}},
+	}
+
+	for testNo, test := range tests {
+		actual, err := FromString(test.src).RemainingTokens()
+		if err != nil {
+			t.Errorf("error lexing test %d. error=%v", testNo, err)
+			continue
+		}
+
+		tokens := make([]string, len(actual))
+		for i, tok := range actual {
+			tokens[i] = tok.String()
+		}
+
+		if strings.Join(tokens, " ") != strings.Join(test.expectedTokens, " ") {
+			t.Errorf("test %d, incorrect tokens. expected=%v, got=%v", testNo, test.expectedTokens, tokens)
+		}
+	}
+}
+
+func TestLexPositions(t *testing.T) {
+	actual, err := FromString("ab => 1\n  [x, y] |\n\nz").RemainingTokens()
+	if err != nil {
+		t.Fatalf("error lexing: %v", err)
+	}
+
+	expected := []string{"1:1", "1:4", "1:7", "1:8", "2:3", "2:4", "2:5", "2:7", "2:8", "2:10", "2:11", "4:1"}
+	if len(actual) != len(expected) {
+		t.Fatalf("incorrect number of tokens. expected=%d, got=%d", len(expected), len(actual))
+	}
+
+	for i, tok := range actual {
+		if pos := fmt.Sprintf("%d:%d", tok.Line, tok.Column); pos != expected[i] {
+			t.Errorf("incorrect position of token %d (%v). expected=%s, got=%s", i, tok, expected[i], pos)
+		}
+	}
+}
+
+func TestContinues(t *testing.T) {
+	tests := map[string]bool{
+		"a | b":   false,
+		"a | b |": true,
+		"{1, 2":   true,
+		"{1, 2}":  false,
+		"a |\n\n": false,
+		"{1,\n\n": false,
+	}
+
+	for src, expected := range tests {
+		lexer := FromString(src)
+		if _, err := lexer.RemainingTokens(); err != nil {
+			t.Errorf("error lexing %q: %v", src, err)
+			continue
+		}
+
+		if lexer.Continues() != expected {
+			t.Errorf("incorrect result for %q. expected=%v, got=%v", src, expected, lexer.Continues())
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	lexer := FromString("// first\na => b // second\n  /* third\n */ c")
+	if _, err := lexer.RemainingTokens(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Comment{
+		{"// first", 1, 1},
+		{"// second", 2, 8},
+		{"/* third\n */", 3, 3},
+	}
+	actual := lexer.Comments()
+	if len(actual) != len(expected) {
+		t.Fatalf("incorrect number of comments. expected=%d, got=%d", len(expected), len(actual))
+	}
+	for i, comment := range actual {
+		if comment != expected[i] {
+			t.Errorf("incorrect comment %d. expected=%v, got=%v", i, expected[i], comment)
+		}
+	}
+}
@@ -4,115 +4,162 @@ import (
 	"fmt"
 	"github.com/howden/cham/ast"
 	"github.com/howden/cham/token"
+	"github.com/pkg/errors"
 )
 
 // arithmetic.go contains the parsing code for arithmetic expressions.
+// The operators are parsed by the precedence climbing parser in expression.go.
 //
 // Context-free grammar accepted by this parser:
-//   <aexp> ::= <aterm> {<addop> <aexp>}
-//   <aterm> ::= <afactor> {<multop> <aterm>}
+//   <aexp> ::= <axor> {<bitwise-or> <axor>}
+//   <axor> ::= <aand> {<bitwise-xor> <aand>}
+//   <aand> ::= <ashift> {<bitwise-and> <ashift>}
+//   <ashift> ::= <asum> {<shiftop> <asum>}
+//   <asum> ::= <aterm> {<addop> <aterm>}
+//   <aterm> ::= <aunary> {<multop> <aunary>}
+//   <aunary> ::= <unaryop> <aunary>
+//   <aunary> ::= <apower>
+//   <apower> ::= <afactor> [<power> <aunary>]
 //   <afactor> ::= <variable>
+//   <afactor> ::= <function-call>
+//   <afactor> ::= <conditional>
 //   <afactor> ::= <openb> <aexp> <closeb>
-
-// Map of "addop" tokens -> a function that creates an AST
-var addOps = map[token.TokenType]func(left ast.IntegerTerm, right ast.IntegerTerm) ast.ArithmeticExp{
-	token.Plus:     ast.Plus,
-	token.Subtract: ast.Subtract,
-}
-
-// Map of "multop" tokens -> a function that creates an AST
-var multOps = map[token.TokenType]func(left ast.IntegerTerm, right ast.IntegerTerm) ast.ArithmeticExp{
-	token.Multiply: ast.Multiply,
-	token.Divide:   ast.Divide,
-	token.Modulo:   ast.Modulo,
+//   <function-call> ::= <ident> <openb> <aexp> {<comma> <aexp>} <closeb>
+//   <conditional> ::= <if> <bexp> <then> <aexp> <else> <aexp>
+
+// Map of arithmetic operator tokens -> the operator, including a function that creates an AST
+var arithmeticOps = map[token.TokenType]binaryOperator{
+	token.Plus:     {precedence: precedenceAdd, arithmetic: ast.Plus},
+	token.Subtract: {precedence: precedenceAdd, arithmetic: ast.Subtract},
+	token.Multiply: {precedence: precedenceMultiply, arithmetic: ast.Multiply},
+	token.Divide:   {precedence: precedenceMultiply, arithmetic: ast.Divide},
+	token.Modulo:   {precedence: precedenceMultiply, arithmetic: ast.Modulo},
+	token.Power:    {precedence: precedencePower, rightAssoc: true, arithmetic: ast.Power},
+
+	token.ReactionChain: {precedence: precedenceBitwiseOr, arithmetic: ast.BitwiseOr},
+	token.Caret:         {precedence: precedenceBitwiseXor, arithmetic: ast.BitwiseXor},
+	token.BitwiseAnd:    {precedence: precedenceBitwiseAnd, arithmetic: ast.BitwiseAnd},
+	token.LeftShift:     {precedence: precedenceShift, arithmetic: ast.LeftShift},
+	token.RightShift:    {precedence: precedenceShift, arithmetic: ast.RightShift},
 }
 
 // Parses an "aexp"
-// <aexp> ::= <aterm> {<addop> <aexp>}
+// <aexp> ::= <axor> {<bitwise-or> <axor>}
 func (parser *Parser) parseAexp() (ast.IntegerTerm, error) {
-	root, err := parser.aterm()
+	exp, err := parser.parseExpression(precedenceBitwiseOr)
 	if err != nil {
 		return nil, err
 	}
 
-	for {
-		operation, ok := addOps[parser.currentToken.Type]
-		if !ok {
-			break
-		}
-		parser.next()
+	term, ok := exp.(ast.IntegerTerm)
+	if !ok {
+		return nil, errors.New("expected an arithmetic expression but got a boolean expression")
+	}
+	return term, nil
+}
 
-		// use root as the left value, parse right from the next token
-		left := root
-		right, err := parser.parseAexp()
+// Parses an "afactor" (except for brackets, which are parsed by parsePrimary)
+// <afactor> ::= <variable>
+// <afactor> ::= <function-call>
+// <afactor> ::= <conditional>
+func (parser *Parser) afactor() (ast.IntegerTerm, error) {
+	if parser.currentToken.Type == token.If {
+		return parser.parseConditional()
+	}
 
-		if err != nil {
-			return nil, err
-		}
+	// an identifier followed by an open bracket is a function call
+	if parser.currentToken.Type == token.Ident && parser.peek(1).Type == token.OpenBracket {
+		return parser.parseFunctionCall()
+	}
 
-		root = operation(left, right)
+	// otherwise, try to parse a variable
+	variable, err := parser.parseVariable()
+	if err != nil {
+		return nil, err
 	}
 
-	return root, nil
+	return variable, nil
 }
 
-// Parses an "aterm"
-// <aterm> ::= <afactor> {<multop> <aterm>}
-func (parser *Parser) aterm() (ast.IntegerTerm, error) {
-	root, err := parser.afactor()
+// Parses a call to a built-in function, or a user-defined function
+// <function-call> ::= <ident> <openb> <aexp> {<comma> <aexp>} <closeb>
+func (parser *Parser) parseFunctionCall() (ast.IntegerTerm, error) {
+	name, err := parser.parseName()
 	if err != nil {
 		return nil, err
 	}
 
+	// user-defined functions are looked up when the program is evaluated, so they can't be checked here
+	builtin, ok := ast.LookupBuiltin(name)
+	if !ok && !parser.functions {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+
+	// skip the open bracket
+	parser.next()
+
+	var args []ast.IntegerTerm
 	for {
-		operation, ok := multOps[parser.currentToken.Type]
-		if !ok {
+		arg, err := parser.parseAexp()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing argument to %s", name)
+		}
+		args = append(args, arg)
+
+		if parser.currentToken.Type != token.Comma {
 			break
 		}
 		parser.next()
+	}
 
-		// use root as the left value, parse right from the next token
-		left := root
-		right, err := parser.aterm()
+	ok, err = parser.expectToken(token.CloseBracket)
+	if !ok {
+		return nil, err
+	}
+	parser.next()
 
-		if err != nil {
-			return nil, err
-		}
+	if builtin == nil {
+		ident, fallback := parser.qualifyReference(name)
+		return ast.FunctionCall{Identifier: ident, Arguments: args, Fallback: fallback}, nil
+	}
 
-		root = operation(left, right)
+	if len(args) != builtin.Arity {
+		return nil, fmt.Errorf("%s expects %d argument(s) but got %d", name, builtin.Arity, len(args))
 	}
 
-	return root, nil
+	return ast.CallBuiltin(builtin, args), nil
 }
 
-// Parses an "afactor"
-// <afactor> ::= <variable>
-// <afactor> ::= <openb> <aexp> <closeb>
-func (parser *Parser) afactor() (ast.IntegerTerm, error) {
-	// try to parse brackets first
-	if parser.currentToken.Type == token.OpenBracket {
-		parser.next()
-
-		// parse inner aexp
-		exp, err := parser.parseAexp()
-		if err != nil {
-			return nil, err
-		}
+// Parses a conditional expression
+// <conditional> ::= <if> <bexp> <then> <aexp> <else> <aexp>
+func (parser *Parser) parseConditional() (ast.IntegerTerm, error) {
+	// skip the if keyword
+	parser.next()
 
-		// ensure bracket is closed after aexp is finished
-		if parser.currentToken.Type != token.CloseBracket {
-			return nil, fmt.Errorf("expected close bracket but got %v instead", parser.currentToken)
-		}
-		parser.next()
+	condition, err := parser.parseBexp()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing condition")
+	}
 
-		return exp, nil
+	if ok, err := parser.expectToken(token.Then); !ok {
+		return nil, err
 	}
+	parser.next()
 
-	// otherwise, try to parse a variable
-	variable, err := parser.parseVariable()
+	then, err := parser.parseAexp()
 	if err != nil {
+		return nil, errors.Wrap(err, "error parsing 'then' expression")
+	}
+
+	if ok, err := parser.expectToken(token.Else); !ok {
 		return nil, err
 	}
+	parser.next()
 
-	return variable, nil
+	otherwise, err := parser.parseAexp()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing 'else' expression")
+	}
+
+	return ast.Conditional(condition, then, otherwise), nil
 }
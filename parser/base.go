@@ -5,6 +5,7 @@ import (
 	"github.com/howden/cham/ast"
 	"github.com/howden/cham/token"
 	"strconv"
+	"strings"
 )
 
 // Parses a variable - either a number or an identifier
@@ -49,7 +50,24 @@ func (parser *Parser) parseNumber() (int, error) {
 	return sign * i, nil
 }
 
+// Parses an identifier, which cannot contain dots
 func (parser *Parser) parseIdent() (string, error) {
+	ident, err := parser.parseName()
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(ident, ".") {
+		return "", fmt.Errorf("identifier %s cannot contain '.'", ident)
+	}
+	return ident, nil
+}
+
+// Parses the name of a definition, which may contain dots for namespacing (e.g. math.max)
+func (parser *Parser) parseName() (string, error) {
+	if parser.currentToken.Type.IsKeyword() {
+		return "", fmt.Errorf("%v is a reserved keyword and cannot be used as an identifier", parser.currentToken.Type)
+	}
+
 	ok, err := parser.expectToken(token.Ident)
 	if !ok {
 		return "", err
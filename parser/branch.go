@@ -0,0 +1,72 @@
+package parser
+
+import (
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/token"
+	"github.com/pkg/errors"
+)
+
+// branch.go contains the parsing code for branches - splitting a solution between multiple reaction chains.
+//
+// A branch is written as the 'split' keyword, followed by an optional predicate in brackets, then each of the
+// branches (reaction chains) enclosed in curly brackets:
+//   split(x%2 == 0) { :sum } { :product }    even numbers are summed, the rest are multiplied
+//   split { :min } { :max }                  each branch receives a copy of the solution
+// An empty branch, {}, leaves its part of the solution unchanged.
+
+// Parses a branch
+func (parser *Parser) parseBranch(store *eval.ReactionStore) (*ast.Branch, error) {
+	if ok, err := parser.expectToken(token.Split); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	branch := &ast.Branch{}
+
+	// parse the (optional) predicate
+	if parser.currentToken.Type == token.OpenBracket {
+		parser.next()
+
+		predicate, err := parser.parseBexp()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing split predicate")
+		}
+		branch.Predicate = predicate
+
+		if ok, err := parser.expectToken(token.CloseBracket); !ok {
+			return nil, err
+		}
+		parser.next()
+	}
+
+	// parse the branches
+	for parser.currentToken.Type == token.OpenCurlyBracket {
+		parser.next()
+
+		var stages []ast.Stage
+		if parser.currentToken.Type != token.CloseCurlyBracket {
+			var err error
+			stages, err = parser.parseReactions(store)
+			if err != nil {
+				return nil, errors.Wrap(err, "error parsing branch")
+			}
+		}
+
+		if ok, err := parser.expectToken(token.CloseCurlyBracket); !ok {
+			return nil, err
+		}
+		parser.next()
+
+		branch.Branches = append(branch.Branches, stages)
+	}
+
+	if branch.Predicate != nil && len(branch.Branches) != 2 {
+		return nil, errors.Errorf("a split with a predicate must have exactly 2 branches, but got %d", len(branch.Branches))
+	}
+	if len(branch.Branches) < 2 {
+		return nil, errors.Errorf("a split must have at least 2 branches, but got %d", len(branch.Branches))
+	}
+
+	return branch, nil
+}
@@ -1,12 +1,12 @@
 package parser
 
 import (
-	"fmt"
 	"github.com/howden/cham/ast"
 	"github.com/howden/cham/token"
 )
 
-// comparison.go contains the parsing code for comparisons.
+// comparison.go contains the comparison operators.
+// Comparisons are parsed by the precedence climbing parser in expression.go.
 //
 // Context-free grammar accepted by this parser:
 //   <comp-op> ::= '<' | '>' | '<=' | '>=' | '==' | '!='
@@ -21,24 +21,3 @@ var comparisonAsts = map[token.TokenType]func(left ast.IntegerTerm, right ast.In
 	token.LessThanOrEqual:    ast.LessThanEqual,
 	token.GreaterThanOrEqual: ast.GreaterThanEqual,
 }
-
-// Parses a comparison
-func (parser *Parser) parseComparison() (ast.BooleanTerm, error) {
-	left, err := parser.parseAexp()
-	if err != nil {
-		return nil, err
-	}
-
-	comparison, ok := comparisonAsts[parser.currentToken.Type]
-	if !ok {
-		return nil, fmt.Errorf("expected comparison operator but got %v", parser.currentToken)
-	}
-	parser.next()
-
-	right, err := parser.parseAexp()
-	if err != nil {
-		return nil, err
-	}
-
-	return comparison(left, right), nil
-}
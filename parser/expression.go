@@ -0,0 +1,217 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/token"
+)
+
+// expression.go contains the precedence climbing parser shared by arithmetic and boolean expressions.
+//
+// A single parser is used for both kinds of expression, as a bracketed expression could be either, e.g. in the
+// condition (x+1) > 2 the brackets contain an aexp, but in (x > 1) && y > 2 they contain a bexp.
+// The kind of each operand is checked as the expression is built.
+//
+// Operator precedence, from loosest to tightest:
+//   ||                   left associative
+//   &&                   left associative
+//   <, >, <=, >=, ==, != non associative
+//   |                    left associative
+//   ^                    left associative
+//   &                    left associative
+//   <<, >>               left associative
+//   +, -                 left associative
+//   *, /, %              left associative
+//   -, ~ (unary)
+//   **                   right associative
+//
+// The boolean not operator applies to a comparison, so !x > 1 is the same as !(x > 1).
+// The bitwise or operator is the same token as the reaction chain operator, so a | followed by a stage is not part of
+// the expression.
+
+// Precedence levels of the operators
+const (
+	precedenceOr = iota + 1
+	precedenceAnd
+	precedenceComparison
+	precedenceBitwiseOr
+	precedenceBitwiseXor
+	precedenceBitwiseAnd
+	precedenceShift
+	precedenceAdd
+	precedenceMultiply
+	precedenceUnary
+	precedencePower
+)
+
+// A binary operator, which combines two expressions of the same kind
+type binaryOperator struct {
+	precedence int
+	rightAssoc bool
+
+	// Exactly one of these is set, depending on the kind of the operands and the result
+	arithmetic func(left ast.IntegerTerm, right ast.IntegerTerm) ast.ArithmeticExp
+	comparison func(left ast.IntegerTerm, right ast.IntegerTerm) ast.BooleanTerm
+	boolean    func(left ast.BooleanTerm, right ast.BooleanTerm) ast.BooleanTerm
+}
+
+// Map of binary operator tokens -> the operator
+var binaryOperators = map[token.TokenType]binaryOperator{}
+
+func init() {
+	for tok, op := range arithmeticOps {
+		binaryOperators[tok] = op
+	}
+	for tok, create := range comparisonAsts {
+		binaryOperators[tok] = binaryOperator{precedence: precedenceComparison, comparison: create}
+	}
+	for tok, op := range booleanOps {
+		binaryOperators[tok] = op
+	}
+}
+
+// Parses an expression containing operators with at least the given precedence.
+// The result is either an ast.IntegerTerm or an ast.BooleanTerm.
+func (parser *Parser) parseExpression(minPrecedence int) (interface{}, error) {
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		name := parser.currentToken.Type
+
+		// the lexer reads <~ as the cooling operator, but within an expression it is a less than comparison followed
+		// by a bitwise not, e.g. x<~y is x < ~y
+		if name == token.CoolingOp {
+			name = token.LessThan
+		}
+
+		op, ok := binaryOperators[name]
+		if !ok || op.precedence < minPrecedence {
+			return left, nil
+		}
+
+		// a 'plus' followed by a reaction is parallel composition, not addition
+		if parser.currentToken.Type == token.Plus && parser.isReactionAhead(1) {
+			return left, nil
+		}
+
+		// a '|' followed by a stage is the reaction chain operator, not bitwise or
+		if parser.currentToken.Type == token.ReactionChain && parser.isStageAhead(1) {
+			return left, nil
+		}
+
+		// comparisons are non associative, so a comparison operator after a boolean expression is not part of the
+		// expression (e.g. it could be the priority composition operator, >)
+		if _, isBoolean := left.(ast.BooleanTerm); isBoolean && op.comparison != nil {
+			return left, nil
+		}
+
+		if parser.currentToken.Type == token.CoolingOp {
+			// the rest of the token is the bitwise not of the right operand
+			parser.currentToken.Type = token.BitwiseNot
+		} else {
+			parser.next()
+		}
+
+		// a left associative operator only takes operators of a higher precedence as its right operand
+		next := op.precedence + 1
+		if op.rightAssoc {
+			next = op.precedence
+		}
+		right, err := parser.parseExpression(next)
+		if err != nil {
+			return nil, err
+		}
+
+		left, err = combine(op, name, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Combines two operands using a binary operator, checking that they are the right kind of expression
+func combine(op binaryOperator, name token.TokenType, left interface{}, right interface{}) (interface{}, error) {
+	if op.boolean != nil {
+		l, lok := left.(ast.BooleanTerm)
+		r, rok := right.(ast.BooleanTerm)
+		if !lok || !rok {
+			return nil, fmt.Errorf("operator %v expects boolean expressions", name)
+		}
+		return op.boolean(l, r), nil
+	}
+
+	l, lok := left.(ast.IntegerTerm)
+	r, rok := right.(ast.IntegerTerm)
+	if !lok || !rok {
+		return nil, fmt.Errorf("operator %v expects arithmetic expressions", name)
+	}
+	if op.comparison != nil {
+		return op.comparison(l, r), nil
+	}
+	return op.arithmetic(l, r), nil
+}
+
+// Map of unary arithmetic operator tokens -> a function that creates an AST
+var unaryOps = map[token.TokenType]func(term ast.IntegerTerm) ast.IntegerTerm{
+	token.Subtract:   ast.Negate,
+	token.BitwiseNot: ast.BitwiseNot,
+}
+
+// Parses an expression which may be preceded by a unary operator (-, ~ or !)
+func (parser *Parser) parseUnary() (interface{}, error) {
+	switch parser.currentToken.Type {
+	case token.Subtract, token.BitwiseNot:
+		name := parser.currentToken.Type
+		parser.next()
+
+		exp, err := parser.parseExpression(precedenceUnary + 1)
+		if err != nil {
+			return nil, err
+		}
+		term, ok := exp.(ast.IntegerTerm)
+		if !ok {
+			return nil, fmt.Errorf("operator %v expects an arithmetic expression", name)
+		}
+		return unaryOps[name](term), nil
+
+	case token.Not:
+		parser.next()
+
+		exp, err := parser.parseExpression(precedenceComparison)
+		if err != nil {
+			return nil, err
+		}
+		term, ok := exp.(ast.BooleanTerm)
+		if !ok {
+			return nil, fmt.Errorf("operator %v expects a boolean expression", token.Not)
+		}
+		return ast.BooleanNot(term), nil
+	}
+
+	return parser.parsePrimary()
+}
+
+// Parses a primary expression - a bracketed expression, or an afactor
+func (parser *Parser) parsePrimary() (interface{}, error) {
+	if parser.currentToken.Type != token.OpenBracket {
+		return parser.afactor()
+	}
+	parser.next()
+
+	// parse the inner expression, which could be either kind
+	exp, err := parser.parseExpression(precedenceOr)
+	if err != nil {
+		return nil, err
+	}
+
+	// ensure bracket is closed after the expression is finished
+	if parser.currentToken.Type != token.CloseBracket {
+		return nil, fmt.Errorf("expected close bracket but got %v instead", parser.currentToken)
+	}
+	parser.next()
+
+	return exp, nil
+}
@@ -0,0 +1,123 @@
+package parser
+
+import (
+	"bytes"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/lexer"
+	"strings"
+)
+
+// format.go contains the formatter, which rewrites source code in the canonical form given by ast.Source.
+//
+// Each statement is written on its own line. Comments are kept: a comment on the last line of a statement stays at the
+// end of that line, and any other comment is written on its own line before the statement it precedes (or is inside).
+// A single blank line is kept wherever the statements (or comments) were separated by blank lines.
+
+// A statement of the source being formatted, along with the lines it spans
+type formattedStatement struct {
+	src       string
+	startLine int
+	endLine   int
+	leading   []lexer.Comment
+	trailing  []lexer.Comment
+}
+
+// Formats the statements in the source code
+func Format(src []byte, fileName string) ([]byte, error) {
+	lex := lexer.FromReader(bytes.NewReader(src), fileName)
+	parser := NewParser(lex)
+
+	// a store is needed to parse references to named solutions, but nothing is defined in it
+	store := eval.NewReactionStore()
+
+	var statements []*formattedStatement
+	for {
+		parser.skipSemicolons()
+		startLine := parser.currentToken.Line
+
+		program, def, err := parser.ParseStatement(store)
+		if err != nil {
+			return nil, err
+		}
+		if program == nil && def == nil {
+			break
+		}
+
+		var node interface{} = def
+		if program != nil {
+			node = program
+		}
+		statements = append(statements, &formattedStatement{
+			src:       ast.Source(node),
+			startLine: startLine,
+			endLine:   parser.currentToken.Line,
+		})
+	}
+
+	// the comments after the last statement
+	var trailing []lexer.Comment
+	for _, comment := range lex.Comments() {
+		if stmt := commentStatement(statements, comment.Line); stmt == nil {
+			trailing = append(trailing, comment)
+		} else if comment.Line == stmt.endLine {
+			stmt.trailing = append(stmt.trailing, comment)
+		} else {
+			stmt.leading = append(stmt.leading, comment)
+		}
+	}
+
+	var out strings.Builder
+	lastLine := 0
+	writeLine := func(line string, startLine int, endLine int) {
+		if lastLine > 0 && startLine > lastLine+1 {
+			out.WriteString("\n")
+		}
+		out.WriteString(line + "\n")
+		lastLine = endLine
+	}
+
+	for _, stmt := range statements {
+		for _, comment := range stmt.leading {
+			// a comment inside the statement is moved before it, so is treated as if it starts on the same line
+			startLine := comment.Line
+			if startLine > stmt.startLine {
+				startLine = stmt.startLine
+			}
+			writeLine(comment.Text, startLine, commentEndLine(comment))
+		}
+
+		line := stmt.src
+		for _, comment := range stmt.trailing {
+			line += " " + comment.Text
+		}
+		writeLine(line, stmt.startLine, stmt.endLine)
+	}
+	for _, comment := range trailing {
+		writeLine(comment.Text, comment.Line, commentEndLine(comment))
+	}
+
+	return []byte(out.String()), nil
+}
+
+// Returns the statement that a comment on the given line belongs to: the last statement ending on that line, or
+// otherwise the first statement which ends after it. Returns nil if the comment is after the last statement.
+func commentStatement(statements []*formattedStatement, line int) *formattedStatement {
+	for i, stmt := range statements {
+		if stmt.endLine < line {
+			continue
+		}
+		// several statements can be on the same line, in which case the comment is at the end of the last one
+		for stmt.endLine == line && i+1 < len(statements) && statements[i+1].endLine == line {
+			i++
+			stmt = statements[i]
+		}
+		return stmt
+	}
+	return nil
+}
+
+// Returns the line that a comment ends on, which is after the line it starts on if it is a multi-line /* comment */
+func commentEndLine(comment lexer.Comment) int {
+	return comment.Line + strings.Count(comment.Text, "\n")
+}
@@ -0,0 +1,149 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/token"
+	"github.com/pkg/errors"
+)
+
+// Parses a number tuple in the program input, and adds it to the solution.
+// The tuple can also be written as a generator - a range of ints (2..10), a stepped range of ints (1..9 step 2),
+// or a repeated tuple or range (0^5 or 5 * 0).
+func (parser *Parser) parseInputTuple(solution *ast.Solution) error {
+	count, repeated := 1, false
+
+	// count * tuple
+	if parser.currentToken.Type == token.Number && parser.peek(1).Type == token.Multiply {
+		c, err := parser.parseRepetitionCount()
+		if err != nil {
+			return err
+		}
+		parser.next()
+		count, repeated = c, true
+	}
+
+	var generator ast.Generator
+	if parser.isRangeAhead() {
+		r, err := parser.parseRange()
+		if err != nil {
+			return errors.Wrap(err, "error parsing range")
+		}
+		generator = r
+	} else {
+		tuple, err := parser.parseNumberTuple()
+		if err != nil {
+			return err
+		}
+		generator = &ast.Repetition{Tuple: *tuple}
+	}
+
+	// tuple ^ count
+	if parser.currentToken.Type == token.Caret {
+		if repeated {
+			return errors.New("a tuple cannot be repeated using both '*' and '^'")
+		}
+		parser.next()
+
+		c, err := parser.parseRepetitionCount()
+		if err != nil {
+			return err
+		}
+		count = c
+	}
+
+	switch g := generator.(type) {
+	case *ast.Range:
+		if err := checkRangeSize(g, count); err != nil {
+			return err
+		}
+		g.Count = count
+	case *ast.Repetition:
+		// a single tuple doesn't need a generator
+		if count == 1 {
+			solution.Tuples = append(solution.Tuples, g.Tuple)
+			return nil
+		}
+		g.Count = count
+	}
+
+	solution.Generators = append(solution.Generators, generator)
+	return nil
+}
+
+// Tests whether the current token is the beginning of a range
+func (parser *Parser) isRangeAhead() bool {
+	if parser.currentToken.Type == token.Subtract {
+		return parser.peek(1).Type == token.Number && parser.peek(2).Type == token.Range
+	}
+	return parser.currentToken.Type == token.Number && parser.peek(1).Type == token.Range
+}
+
+// Parses a range of ints, with an optional step
+func (parser *Parser) parseRange() (*ast.Range, error) {
+	start, err := parser.parseNumber()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing range start")
+	}
+
+	ok, err := parser.expectToken(token.Range)
+	if !ok {
+		return nil, err
+	}
+	parser.next()
+
+	end, err := parser.parseNumber()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing range end")
+	}
+	if start > end {
+		return nil, fmt.Errorf("range start %d is greater than range end %d", start, end)
+	}
+
+	step := 1
+
+	// 'step' is only a keyword here, so it isn't reserved as an identifier
+	if parser.currentToken.Type == token.Ident && parser.currentToken.Literal == "step" {
+		parser.next()
+
+		step, err = parser.parseNumber()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing range step")
+		}
+		if step < 1 {
+			return nil, fmt.Errorf("range step must be positive, got %d", step)
+		}
+	}
+
+	return &ast.Range{Start: start, End: end, Step: step}, nil
+}
+
+// Parses the number of times a tuple is repeated
+func (parser *Parser) parseRepetitionCount() (int, error) {
+	count, err := parser.parseNumber()
+	if err != nil {
+		return 0, errors.Wrap(err, "error parsing repetition count")
+	}
+	if count < 0 {
+		return 0, fmt.Errorf("repetition count cannot be negative, got %d", count)
+	}
+	if count > ast.MaxCardinality {
+		return 0, fmt.Errorf("repetition count %d is greater than the maximum of %d", count, ast.MaxCardinality)
+	}
+	return count, nil
+}
+
+// Checks that a range repeated the given number of times doesn't generate too many molecules
+func checkRangeSize(r *ast.Range, count int) error {
+	if count == 0 {
+		return nil
+	}
+
+	// the distance is divided as an unsigned int, as it can be larger than the largest int.
+	// The range has steps+1 ints, so it generates (steps+1)*count molecules.
+	steps := uint(r.End-r.Start) / uint(r.Step)
+	if steps >= uint(ast.MaxCardinality/count) {
+		return fmt.Errorf("range %d..%d generates more than the maximum of %d molecules", r.Start, r.End, ast.MaxCardinality)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package parser
+
+import (
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/token"
+	"github.com/pkg/errors"
+)
+
+// loop.go contains the parsing code for loops - chains of reactions which are repeated.
+//
+// A loop is written as a reaction chain enclosed in brackets, followed by a '*' and an optional maximum number of
+// iterations:
+//   (:a | :b)*      repeats :a then :b until neither of them changes the solution
+//   (:a | :b)*10    as above, but stops after at most 10 iterations
+
+// Tests whether the current token is the beginning of a loop.
+// This is used to tell apart a loop from a reaction which starts with a reaction pattern, e.g. (r) => {}
+func (parser *Parser) isLoopAhead() bool {
+	if parser.currentToken.Type != token.OpenBracket {
+		return false
+	}
+	return parser.peek(1).Type != token.Ident || parser.peek(2).Type != token.CloseBracket
+}
+
+// Parses a loop
+func (parser *Parser) parseLoop(store *eval.ReactionStore) (*ast.Loop, error) {
+	if ok, err := parser.expectToken(token.OpenBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	stages, err := parser.parseReactions(store)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing loop")
+	}
+
+	if ok, err := parser.expectToken(token.CloseBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	if ok, err := parser.expectToken(token.Multiply); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	// parse the (optional) maximum number of iterations
+	limit := 0
+	if parser.currentToken.Type == token.Number {
+		limit, err = parser.parseNumber()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing loop limit")
+		}
+
+		if limit <= 0 {
+			return nil, errors.New("the maximum number of loop iterations must be positive")
+		}
+	}
+
+	return &ast.Loop{Stages: stages, Limit: limit}, nil
+}
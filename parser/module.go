@@ -0,0 +1,178 @@
+package parser
+
+import (
+	"bytes"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/lexer"
+	"github.com/howden/cham/token"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Parses an import statement, e.g. import "lib/sorting.cham" as sort
+// If no namespace is given, the name of the file (without its extension) is used.
+func (parser *Parser) parseImport() (*ast.Import, error) {
+	// skip the import keyword
+	parser.next()
+
+	if ok, err := parser.expectToken(token.String); !ok {
+		return nil, errors.Wrap(err, "error parsing import path")
+	}
+	path := parser.currentToken.Literal
+	if path == "" {
+		return nil, errors.New("import path cannot be empty")
+	}
+	parser.next()
+
+	var namespace string
+	if parser.currentToken.Type == token.As {
+		parser.next()
+
+		ns, err := parser.parseIdent()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing import namespace")
+		}
+		namespace = ns
+	} else {
+		namespace = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if !isIdent(namespace) {
+			return nil, errors.Errorf("%q cannot be used as a namespace, so one must be given using 'as'", namespace)
+		}
+	}
+
+	if namespace == eval.StdNamespace && parser.namespace == "" {
+		return nil, errors.Errorf("the namespace %s is reserved for the standard library", namespace)
+	}
+
+	return &ast.Import{Path: path, Namespace: parser.qualify(namespace)}, nil
+}
+
+// Tests whether the string is a valid identifier
+func isIdent(s string) bool {
+	tokens, err := lexer.FromString(s).RemainingTokens()
+	return err == nil && len(tokens) == 1 && tokens[0].Type == token.Ident && !strings.Contains(s, ".")
+}
+
+// Imports the module at the path of the import statement into the store, along with any modules that it imports.
+// A relative path is resolved against the directory of the importing file, or the working directory if the import
+// isn't from a file (from is empty).
+//
+// Each module is only loaded once. Importing it again in a different namespace defines aliases for its definitions.
+func Import(imp *ast.Import, from string, store *eval.ReactionStore) error {
+	// the importing file can't be imported by its own imports either
+	var importing []string
+	if path, err := filepath.Abs(from); from != "" && err == nil {
+		importing = append(importing, path)
+	}
+
+	_, err := importModule(imp, from, store, importing)
+	return err
+}
+
+// Imports a module, returning the definitions it made.
+// The importing slice holds the paths of the modules which are currently being imported, to detect import cycles.
+func importModule(imp *ast.Import, from string, store *eval.ReactionStore, importing []string) ([]ast.Definition, error) {
+	path := imp.Path
+	if !filepath.IsAbs(path) && from != "" {
+		path = filepath.Join(filepath.Dir(from), path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error importing %s", imp.Path)
+	}
+
+	for i, p := range importing {
+		if p == path {
+			cycle := append(importing[i:len(importing):len(importing)], path)
+			return nil, errors.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	if module, ok := store.GetModule(path); ok {
+		return aliasModule(module, imp.Namespace, store), nil
+	}
+
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error importing %s", imp.Path)
+	}
+
+	module := &eval.Module{Path: path, Namespace: imp.Namespace}
+	if err := loadModule(module, src, store, append(importing[:len(importing):len(importing)], path)); err != nil {
+		return nil, errors.Wrapf(err, "error importing %s", imp.Path)
+	}
+	return module.Definitions, nil
+}
+
+// Loads a module from its source (rather than from a file), e.g. the standard library.
+// The path is only used to identify the module, and any imports are resolved relative to the working directory.
+func LoadModule(path string, namespace string, src []byte, store *eval.ReactionStore) error {
+	return loadModule(&eval.Module{Path: path, Namespace: namespace}, src, store, nil)
+}
+
+// Parses the statements of a module, and adds its definitions to the store
+func loadModule(module *eval.Module, src []byte, store *eval.ReactionStore, importing []string) error {
+	from := ""
+	if len(importing) > 0 {
+		from = importing[len(importing)-1]
+	}
+
+	parser := NewParser(lexer.FromReader(bytes.NewReader(src), module.Path))
+	parser.namespace = module.Namespace
+	for {
+		program, def, err := parser.ParseStatement(store)
+		if err != nil {
+			return err
+		}
+		if program != nil {
+			return errors.New("a module can only contain definitions and imports")
+		}
+		if def == nil {
+			break
+		}
+
+		if nested, ok := def.(*ast.Import); ok {
+			defs, err := importModule(nested, from, store, importing)
+			if err != nil {
+				return err
+			}
+			module.Definitions = append(module.Definitions, defs...)
+		} else {
+			store.Define(def)
+			module.Definitions = append(module.Definitions, def)
+		}
+	}
+
+	store.PutModule(module)
+	return nil
+}
+
+// Defines aliases for the definitions of a module which has already been imported, using a different namespace.
+// The aliased definitions still refer to the original definitions, so the module isn't loaded again.
+func aliasModule(module *eval.Module, namespace string, store *eval.ReactionStore) []ast.Definition {
+	if namespace == module.Namespace {
+		return module.Definitions
+	}
+
+	defs := make([]ast.Definition, 0, len(module.Definitions))
+	for _, def := range module.Definitions {
+		switch def := def.(type) {
+		case *ast.ReactionPointer:
+			alias := *def
+			alias.Identifier = ast.Ident(namespace + strings.TrimPrefix(def.Identifier.Name(), module.Namespace))
+			defs = append(defs, &alias)
+		case *ast.FunctionDefinition:
+			alias := *def
+			alias.Identifier = ast.Ident(namespace + strings.TrimPrefix(def.Identifier.Name(), module.Namespace))
+			defs = append(defs, &alias)
+		}
+	}
+
+	for _, def := range defs {
+		store.Define(def)
+	}
+	return defs
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"bytes"
 	"fmt"
+	"github.com/howden/cham/ast"
 	"github.com/howden/cham/lexer"
 	"github.com/howden/cham/token"
 	"github.com/pkg/errors"
@@ -14,6 +15,15 @@ type Parser struct {
 
 	// Holds the current token under consideration by the parser
 	currentToken token.Token
+
+	// Holds tokens which have already been read from the lexer, ahead of the current token
+	lookahead []token.Token
+
+	// Whether calls to user-defined functions are allowed (only in repl mode)
+	functions bool
+
+	// The namespace of the module being parsed, which prefixes the names of its definitions and the references to them
+	namespace string
 }
 
 // Creates a new parser using the given Lexer as a source of input tokens
@@ -25,9 +35,39 @@ func NewParser(lexer *lexer.Lexer) *Parser {
 
 // Advance to the next token
 func (parser *Parser) next() {
+	if len(parser.lookahead) > 0 {
+		parser.currentToken = parser.lookahead[0]
+		parser.lookahead = parser.lookahead[1:]
+		return
+	}
 	parser.currentToken = parser.lexer.NextToken()
 }
 
+// Returns the token n places ahead of the current token, without advancing the parser
+func (parser *Parser) peek(n int) token.Token {
+	for len(parser.lookahead) < n {
+		parser.lookahead = append(parser.lookahead, parser.lexer.NextToken())
+	}
+	return parser.lookahead[n-1]
+}
+
+// Returns the name qualified by the namespace of the module being parsed, e.g. max in the module sort is sort.max
+func (parser *Parser) qualify(name string) string {
+	if parser.namespace == "" {
+		return name
+	}
+	return parser.namespace + "." + name
+}
+
+// Returns the identifier of a reference to a definition, qualified by the namespace of the module being parsed, along
+// with the name as written to fall back to if the module doesn't define it (which is empty outside of a module)
+func (parser *Parser) qualifyReference(name string) (ident ast.Identifier, fallback ast.Identifier) {
+	if parser.namespace == "" {
+		return ast.Ident(name), ast.Identifier{}
+	}
+	return ast.Ident(parser.qualify(name)), ast.Ident(name)
+}
+
 // Tests whether the token matches the expected token type
 func expect(token token.Token, expected token.TokenType) (ok bool, err error) {
 	if token.Type != expected {
@@ -42,7 +82,7 @@ func (parser *Parser) expectToken(expected token.TokenType) (ok bool, err error)
 }
 
 // Custom error wrapper which additionally contains information
-// about the state of the lexer when the error occurred.
+// about the position of the token being parsed when the error occurred.
 // (where in the src code caused the parsing error!)
 type ParserError struct {
 	cause              error
@@ -65,10 +105,10 @@ func (err *ParserError) Unwrap() error {
 // function to create an error wrapper given the parser
 func (parser *Parser) wrapError(err error) *ParserError {
 	err = errors.WithStack(err)
-	line, col := 0, 0
+	line, col := parser.currentToken.Line, parser.currentToken.Column
 
-	pos := parser.lexer.Pos()
-	if pos.IsValid() {
+	// fall back to the position of the lexer if the token doesn't have one
+	if pos := parser.lexer.Pos(); line == 0 && pos.IsValid() {
 		line = pos.Line
 		col = pos.Column
 	}
@@ -76,20 +116,34 @@ func (parser *Parser) wrapError(err error) *ParserError {
 	return &ParserError{cause: err, LexerCurrentLine: line, LexerCurrentColumn: col}
 }
 
+// Prints a parser error, along with the line of the src where it occurred
 func PrintParserError(src string, err error) {
 	if pe, ok := err.(*ParserError); ok {
 		fmt.Println(err)
-		fmt.Printf("\n%s\n", src)
-		fmt.Printf("%s^ HERE\n", strings.Repeat(" ", pe.LexerCurrentColumn-2))
+		fmt.Printf("\n%s\n", sourceLine(src, pe.LexerCurrentLine))
+		indent := 0
+		if pe.LexerCurrentColumn > 0 {
+			indent = pe.LexerCurrentColumn - 1
+		}
+		fmt.Printf("%s^ HERE\n", strings.Repeat(" ", indent))
 	} else {
 		fmt.Println(err)
 	}
 }
 
+// Returns the given line of the src (starting from 1), or the whole src if there is no such line
+func sourceLine(src string, line int) string {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return src
+	}
+	return lines[line-1]
+}
+
 func FormatErrorWithParserLocation(err error) error {
 	if pe, ok := err.(*ParserError); ok {
 		var buf bytes.Buffer
-		_, _ = fmt.Fprintf(&buf, "%s^ ", strings.Repeat(" ", pe.LexerCurrentColumn-1))
+		_, _ = fmt.Fprintf(&buf, "%s^ ", strings.Repeat(" ", pe.LexerCurrentColumn))
 		_, _ = fmt.Fprint(&buf, err)
 		return errors.New(buf.String())
 	} else {
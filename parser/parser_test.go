@@ -0,0 +1,629 @@
+package parser
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/docs"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/lexer"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Parses a list of reaction definitions into a new store
+func defineReactions(t *testing.T, defs ...string) *eval.ReactionStore {
+	store := eval.NewReactionStore()
+	for _, def := range defs {
+		_, definition, err := NewParser(lexer.FromString(def)).ParseProgramOrDefinitionFully(store)
+		if err != nil {
+			t.Fatalf("error parsing definition %q: %v", def, err)
+		}
+		store.Define(definition)
+	}
+	return store
+}
+
+// Parses each of the sources, checking that it fails to parse.
+// The sources are parsed as programs or definitions if a store is given, and otherwise only as programs.
+func testParseErrors(t *testing.T, store *eval.ReactionStore, tests []string) {
+	t.Helper()
+	for _, src := range tests {
+		var err error
+		if store == nil {
+			_, err = NewParser(lexer.FromString(src)).ParseProgramFully()
+		} else {
+			_, _, err = NewParser(lexer.FromString(src)).ParseProgramOrDefinitionFully(store)
+		}
+		if err == nil {
+			t.Errorf("expected error parsing %q", src)
+		}
+	}
+}
+
+func TestParallelCompositionParse(t *testing.T) {
+	program, err := NewParser(lexer.FromString("{1} | x => x+1 + y => y-1 | x,y => x+y")).ParseProgramFully()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(program.Reactions) != 2 {
+		t.Fatalf("incorrect number of stages. expected=2, got=%d", len(program.Reactions))
+	}
+
+	group, ok := program.Reactions[0].(*ast.ReactionGroup)
+	if !ok {
+		t.Fatalf("expected first stage to be a group but got %v", program.Reactions[0])
+	}
+	if len(group.Reactions) != 2 {
+		t.Errorf("incorrect number of reactions in group. expected=2, got=%d", len(group.Reactions))
+	}
+}
+
+func TestStructuralRuleParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{1} | (r), x <~ [x, y]",
+		"{1} | {(r)} <~> x",
+		"{1} | x <| s <~ [x, 0]",
+		"{1} | [p,q] <~",
+	})
+}
+
+func TestReactionMoleculeParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{([p,q] ~> p, q), 1}",
+		"{(x => x}",
+		"{1} | (r, s) => {}",
+	})
+}
+
+func TestParameterisedDefinitionErrors(t *testing.T) {
+	store := defineReactions(t,
+		"filter_mod(n): x => {} if x%n == 0",
+		"filter_odd: x => {} if x%2 == 0",
+	)
+
+	testParseErrors(t, store, []string{
+		"{1,2,3} | :filter_mod",
+		"{1,2,3} | :filter_mod(1, 2)",
+		"{1,2,3} | :filter_odd(1)",
+		"pair(a, a): x => a",
+		"pair(a,): x => a",
+	})
+}
+
+func TestLoopParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{1} | (x => x)",
+		"{1} | (x => x)*0",
+		"{1} | (x => x)* + x => x",
+		"{1} | (x => x | y => y*",
+	})
+}
+
+func TestBranchParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{1} | split(x > 0) { x => x }",
+		"{1} | split(x > 0) {} {} {}",
+		"{1} | split { x => x }",
+		"{1} | split(x > 0) { x => x",
+	})
+}
+
+func TestNamedSolutionParse(t *testing.T) {
+	program, _, err := NewParser(lexer.FromString("data = {1, 2} | x => [x, 0]")).ParseProgramOrDefinitionFully(eval.NewReactionStore())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if program.Name == nil || program.Name.Name() != "data" {
+		t.Fatalf("incorrect program name. expected=data, got=%v", program.Name)
+	}
+
+	// named solutions are only supported in repl mode
+	testParseErrors(t, nil, []string{"$data | x => x", "data = {1, 2}"})
+}
+
+func TestIdentifierParseErrors(t *testing.T) {
+	tests := []struct {
+		src           string
+		expectedError string
+	}{
+		{"if: x, y => x", "if is a reserved keyword and cannot be used as an identifier"},
+		{"where = {1, 2}", "where is a reserved keyword and cannot be used as an identifier"},
+		{"fn split(a) = a", "split is a reserved keyword and cannot be used as an identifier"},
+		{"{1} | once => once", "once is a reserved keyword and cannot be used as an identifier"},
+		{"{1} | math.x => math.x", "identifier math.x cannot contain '.'"},
+		{"{1} | x => [y, 0] where then = x + 1", "then is a reserved keyword and cannot be used as an identifier"},
+	}
+
+	for _, test := range tests {
+		_, _, err := NewParser(lexer.FromString(test.src)).ParseProgramOrDefinitionFully(eval.NewReactionStore())
+		if err == nil {
+			t.Errorf("expected error parsing %q", test.src)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.expectedError) {
+			t.Errorf("incorrect error for %q. expected to contain %q, got=%q", test.src, test.expectedError, err.Error())
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	src := `// statements can be separated by line breaks or semicolons, and continued by '|' or unclosed brackets
+sum: x, y => x+y
+max: x, y => x if x > y
+
+data = {1, 2,
+  3, 4}
+$data | :sum; $data | :max
+$data |
+  x => [x, x*2] |
+  // comment
+  [x, y] => y | :sum;
+`
+
+	statements, err := parseStatements(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"sum: x, y => x + y",
+		"max: x, y => x if x > y",
+		"data = {1, 2, 3, 4}",
+		"{$data} | :sum",
+		"{$data} | :max",
+		"{$data} | x => [x, x * 2] | [x, y] => y | :sum",
+	}
+	if len(statements) != len(expected) {
+		t.Fatalf("incorrect number of statements. expected=%d, got=%d", len(expected), len(statements))
+	}
+	for i, statement := range statements {
+		if actual := ast.Source(statement); actual != expected[i] {
+			t.Errorf("incorrect statement %d. expected=%q, got=%q", i+1, expected[i], actual)
+		}
+	}
+}
+
+func TestStatementParseErrors(t *testing.T) {
+	tests := []struct {
+		src          string
+		expectedLine int
+	}{
+		{"{1, 2} | :sum\n{1, 2} | x => x +\n{3}", 2},
+		{"{1, 2} | :sum |\n\n{3} | :sum", 1},
+		{"{1, 2} | :sum {3}", 1},
+		{"{1, 2} | :sum\n\n\n{1, 2} x => x", 4},
+	}
+
+	for _, test := range tests {
+		parser := NewParser(lexer.FromString(test.src))
+
+		var err error
+		for err == nil {
+			var program *ast.Program
+			var def ast.Definition
+			program, def, err = parser.ParseStatement(eval.NewReactionStore())
+			if program == nil && def == nil {
+				break
+			}
+		}
+
+		pe, ok := err.(*ParserError)
+		if !ok {
+			t.Errorf("expected parser error for %q, got %v", test.src, err)
+			continue
+		}
+		if pe.LexerCurrentLine != test.expectedLine {
+			t.Errorf("incorrect error line for %q. expected=%d, got=%d", test.src, test.expectedLine, pe.LexerCurrentLine)
+		}
+	}
+}
+
+// Writes the files to a temporary directory, returning the path of the directory
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// Parses an import statement, and imports it into the store from the given file
+func runImport(t *testing.T, src string, from string, store *eval.ReactionStore) error {
+	_, def, err := NewParser(lexer.FromString(src)).ParseProgramOrDefinitionFully(store)
+	if err != nil {
+		t.Fatalf("error parsing %q: %v", src, err)
+	}
+	imp, ok := def.(*ast.Import)
+	if !ok {
+		t.Fatalf("expected an import statement but got %v", def)
+	}
+	return Import(imp, from, store)
+}
+
+func TestImports(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"lib/sorting.cham": `import "util.cham"
+sort_existing: [i,x], [j,y] => { [i,y], [j,x] } if i<j && x>y
+sort: :util.index | :sort_existing
+`,
+		"lib/util.cham": `fn twice(x) = x * 2
+index: x => [0, x] | [i,x], [j,y] => { [i+1,x], [j,y] } if i==j && x>=y
+`,
+	})
+	main := filepath.Join(dir, "main.cham")
+
+	store := eval.NewReactionStore()
+	for _, src := range []string{`import "lib/sorting.cham" as sort`, `import "lib/util.cham"`, `import "lib/util.cham" as u`} {
+		if err := runImport(t, src, main, store); err != nil {
+			t.Fatalf("error importing %q: %v", src, err)
+		}
+	}
+
+	// the references within a module are resolved to the namespace it is imported into
+	expected := []string{
+		"sort.sort: :sort.util.index | :sort.sort_existing",
+		"sort.sort_existing: [i, x], [j, y] => [i, y], [j, x] if i < j && x > y",
+		"sort.util.index: x => [0, x] | [i, x], [j, y] => [i + 1, x], [j, y] if i == j && x >= y",
+		"u.index: x => [0, x] | [i, x], [j, y] => [i + 1, x], [j, y] if i == j && x >= y",
+		"fn sort.util.twice(x) = x * 2",
+		"fn util.twice(x) = x * 2",
+		"fn u.twice(x) = x * 2",
+	}
+	for _, src := range expected {
+		name := strings.TrimPrefix(src[:strings.IndexAny(src, ":(")], "fn ")
+
+		var def ast.Definition
+		var err error
+		if strings.HasPrefix(src, "fn ") {
+			def, err = store.GetFunction(ast.Ident(name))
+		} else {
+			def, err = store.Get(ast.Ident(name))
+		}
+		if err != nil {
+			t.Errorf("expected %s to be defined: %v", name, err)
+			continue
+		}
+		if actual := ast.Source(def); actual != src {
+			t.Errorf("incorrect definition of %s. expected=%q, got=%q", name, src, actual)
+		}
+	}
+
+	// each module is only loaded once
+	if modules := len(store.Modules()); modules != 2 {
+		t.Errorf("incorrect number of modules loaded. expected=2, got=%d", modules)
+	}
+	if _, err := store.Get(ast.Ident("sort_existing")); err == nil {
+		t.Errorf("expected imported definitions to be namespaced")
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.cham":       `import "b.cham"`,
+		"b.cham":       `import "a.cham"`,
+		"program.cham": `{1, 2} | x, y => x + y`,
+		"invalid.cham": `max: x, y =>`,
+		"my-lib.cham":  `max: x, y => x if x > y`,
+	})
+	main := filepath.Join(dir, "main.cham")
+
+	tests := []struct {
+		src           string
+		expectedError string
+	}{
+		{`import "a.cham"`, "import cycle: " + filepath.Join(dir, "a.cham") + " -> " + filepath.Join(dir, "b.cham") + " -> " + filepath.Join(dir, "a.cham")},
+		{`import "program.cham"`, "a module can only contain definitions and imports"},
+		{`import "invalid.cham"`, "error importing invalid.cham"},
+		{`import "missing.cham"`, "error importing missing.cham"},
+	}
+
+	for _, test := range tests {
+		err := runImport(t, test.src, main, eval.NewReactionStore())
+		if err == nil {
+			t.Errorf("expected error importing %q", test.src)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), test.expectedError) {
+			t.Errorf("incorrect error for %q. expected to contain %q, got=%q", test.src, test.expectedError, err.Error())
+		}
+	}
+
+	testParseErrors(t, eval.NewReactionStore(), []string{
+		`import "my-lib.cham"`,
+		`import "lib.cham" as if`,
+		`import "lib.cham" as a.b`,
+		`import ""`,
+		`import lib`,
+	})
+}
+
+func TestInputGeneratorErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{5..1}",
+		"{1..5 step 0}",
+		"{1..5 step -1}",
+		"{1..}",
+		"{-1 * 2}",
+		"{2^-1}",
+		"{2 * 3^2}",
+		"{1.5}",
+		"{0^9223372036854775807, 1}",
+		"{9223372036854775807 * [1, 2]}",
+		"{-9223372036854775807..9223372036854775807}",
+		"{1..16777217}",
+		"{2 * 1..8388609}",
+		"{1..9223372036854775807^2}",
+	})
+}
+
+func TestBuiltinFunctionParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{1} | x => abs()",
+		"{1} | x => abs(x, x)",
+		"{1} | x => pow(x)",
+		"{1} | x => unknown(x)",
+		"{1} | x => max(x, x",
+	})
+}
+
+func TestUserFunctionParseErrors(t *testing.T) {
+	testParseErrors(t, eval.NewReactionStore(), []string{
+		"fn mid = 1",
+		"fn mid() = 1",
+		"fn mid(a, a) = a",
+		"fn mid(a, b) (a+b)/2",
+		"fn max(a, b) = a",
+		"fn (a) = a",
+	})
+}
+
+func TestConditionalExpressionParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{1} | x => if x > 1 then x",
+		"{1} | x => if x > 1 x else 0",
+		"{1} | x => if then x else 0",
+		"{1} | x => if x > 1 then else 0",
+		"{1} | x => [x, if x then 1 else 0]",
+	})
+}
+
+func TestReactionAlternativeParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{1} | x => x else 2",
+		"{1} | x => x if x > 1 else",
+		"{1} | x => x if x > 1 else 2 else 3",
+		"{1} | x => x if x > 1 else 2 if",
+	})
+}
+
+func TestLocalBindingParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{1} | x => x where x = 2",
+		"{1} | x => [x, m] where m = 1, m = 2",
+		"{1} | x => [x, m] where m",
+		"{1} | x => [x, m] where m = ",
+		"{1} | x => [x, m] where",
+	})
+}
+
+func TestCoolingOpInExpression(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		// <~ is a less than comparison followed by a bitwise not within an expression
+		{"{1} | x, y => x if x<~y", "{1} | x, y => x if x < ~y"},
+		{"{1} | x => {} if x<~-2 && x<~~x", "{1} | x => {} if x < ~-2 && x < ~~x"},
+		{"{1} | x => [x, 0] if x<~x else x", "{1} | x => [x, 0] if x < ~x else x"},
+		// but is the cooling operator where a structural rule is expected
+		{"{1} | a, b<~[a, b]", "{1} | a, b <~ [a, b]"},
+		{"{1} | x => x if x > 0 + a, b<~[a, b]", "{1} | x => x if x > 0 + a, b <~ [a, b]"},
+	}
+
+	for _, test := range tests {
+		program, err := NewParser(lexer.FromString(test.src)).ParseProgramFully()
+		if err != nil {
+			t.Errorf("error parsing %q: %v", test.src, err)
+			continue
+		}
+		if actual := ast.Source(program); actual != test.expected {
+			t.Errorf("incorrect source for %q. expected=%q, got=%q", test.src, test.expected, actual)
+		}
+	}
+}
+
+func TestExpressionParseErrors(t *testing.T) {
+	testParseErrors(t, nil, []string{
+		"{1} | x => (x > 1)",
+		"{1} | x => -(x > 1)",
+		"{1} | x => x if !x",
+		"{1} | x => x if x && x > 1",
+		"{1} | x => x if (x > 1) + 1 > 2",
+		"{1} | x => x if x > 1 > 2",
+		"{1} | x => x ** ",
+		"{1} | x => (x + 1",
+	})
+}
+
+func TestSource(t *testing.T) {
+	store := defineReactions(t,
+		"max: x, y => x if x > y",
+		"add(n): [x, y] => x + y + n",
+		"fn mid(a, b) = (a + b) / 2",
+	)
+
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"{3}|x=>[(x)+(x*2),0]", "{3} | x => [x + x * 2, 0]"},
+		{"{3} | x => [(x + 1) * 2, x - (x - 1)]", "{3} | x => [(x + 1) * 2, x - (x - 1)]"},
+		{"{3} | x => [(x ** 2) ** 2, x ** (2 ** 1)]", "{3} | x => [(x ** 2) ** 2, x ** 2 ** 1]"},
+		{"{2, 3} | x => [x ** 2 + -2 ** 2, (-2) ** x, x - -1]", "{2, 3} | x => [x ** 2 + -2 ** 2, (-2) ** x, x - -1]"},
+		{"{2, 3} | x => [-(x + 1), - -x, ~-x, 2 ** - -x]", "{2, 3} | x => [-(x + 1), - -x, ~-x, 2 ** - -x]"},
+		{"{12, 10} | x, y => x | y | x => [(x << 1) ^ 3, x | (x & 1), (x | 1) & 3]", "{12, 10} | x, y => x | y | x => [x << 1 ^ 3, x | x & 1, (x | 1) & 3]"},
+		{"{1..10 step 3, 0^2, 2 * [1, 2]} | :max", "{1..10 step 3, 0 ^ 2, [1, 2] ^ 2} | :max"},
+		{"{-3..3} | x => [-x, ~x] if !(x > 0) || (x % 2 == 0 && x != 2)", "{-3..3} | x => [-x, ~x] if !x > 0 || x % 2 == 0 && x != 2"},
+		{"{-3..3} | x => [x, 0] if !(x > 0 && x < 2) && (x == 1 || x == 2)", "{-3..3} | x => [x, 0] if !(x > 0 && x < 2) && (x == 1 || x == 2)"},
+		{"{1, 2} | x => [mid(x, 4), abs(x)] | :add(1) + :max > [x, y] => {}", "{1, 2} | x => [mid(x, 4), abs(x)] | :add(1) + :max > [x, y] => {}"},
+		{"{1, 2} | x => [if x > 1 then x else 0, (if x > 1 then 1 else 2) + 1]", "{1, 2} | x => [if x > 1 then x else 0, (if x > 1 then 1 else 2) + 1]"},
+		{"{1, 2, 3} | x => {[x, 0]} if x > 2 else [x, 1] if x > 1 else {}", "{1, 2, 3} | x => [x, 0] if x > 2 else [x, 1] if x > 1 else {}"},
+		{"{5} | x => [y, z] where y = x + 1, z = y * 2", "{5} | x => [y, z] where y = x + 1, z = y * 2"},
+		{"{{1, 2}, {3}} | {x, y} => {{x + y}} | {x} <| s => x, {} <| s", "{{1, 2}, {3}} | {x, y} => {{x + y}} | {x} <| s => x, {} <| s"},
+		{"{1, 2, (once x, y => x + y)} | (r) => {}", "{1, 2, (once x, y => x + y)} | (r) => {}"},
+		{"{1, 2, 3, 4} | (x, y => x + y)*2", "{1, 2, 3, 4} | (x, y => x + y)*2"},
+		{"{1, 2, 3, 4} | split(x % 2 == 0) { x, y => x + y } {}", "{1, 2, 3, 4} | split(x % 2 == 0) { x, y => x + y } {}"},
+		{"{[1, 2]} | [a, b] ~> a, b | a, b <~ [a, b]", "{[1, 2]} | [a, b] ~> a, b | a, b <~ [a, b]"},
+		{"{[1, 2]} | [a, b] <~> a, b", "{[1, 2]} | [a, b] <~> a, b"},
+		{"data = {1, 2} | x, y => x + y", "data = {1, 2} | x, y => x + y"},
+		{"max2: x, y => x if x > y | :max", "max2: x, y => x if x > y | :max"},
+		{"sum(n): x, y => (x + y) + n", "sum(n): x, y => x + y + n"},
+		{"fn clamp(x, lo) = max(x, lo) * (-1)", "fn clamp(x, lo) = max(x, lo) * -1"},
+		{`import "lib/sorting.cham" as sort`, `import "lib/sorting.cham" as sort`},
+	}
+
+	for _, test := range tests {
+		program, def, err := NewParser(lexer.FromString(test.src)).ParseProgramOrDefinitionFully(store)
+		if err != nil {
+			t.Errorf("error parsing %q: %v", test.src, err)
+			continue
+		}
+
+		var node interface{} = def
+		if program != nil {
+			node = program
+		}
+		actual := ast.Source(node)
+		if actual != test.expected {
+			t.Errorf("incorrect source for %q. expected=%q, got=%q", test.src, test.expected, actual)
+			continue
+		}
+
+		// the printed source must parse into the same program or definition
+		reprogram, redef, err := NewParser(lexer.FromString(actual)).ParseProgramOrDefinitionFully(store)
+		if err != nil {
+			t.Errorf("error parsing printed source %q: %v", actual, err)
+			continue
+		}
+		var reparsed interface{} = redef
+		if reprogram != nil {
+			reparsed = reprogram
+		}
+		if expected, actual := fmt.Sprint(node), fmt.Sprint(reparsed); expected != actual {
+			t.Errorf("printed source of %q gives a different AST.\nexpected=%s\ngot=%s", test.src, expected, actual)
+		}
+	}
+}
+
+// Parses each of the statements in the source, returning the programs and definitions
+func parseStatements(src string) ([]interface{}, error) {
+	parser := NewParser(lexer.FromString(src))
+	store := eval.NewReactionStore()
+
+	var statements []interface{}
+	for {
+		program, def, err := parser.ParseStatement(store)
+		if err != nil {
+			return nil, err
+		}
+		if program != nil {
+			statements = append(statements, program)
+		} else if def != nil {
+			statements = append(statements, def)
+		} else {
+			return statements, nil
+		}
+	}
+}
+
+func TestSourceRoundTrip(t *testing.T) {
+	sources := []string{
+		string(docs.Programs),
+		"{1, 2, 3} | x => [x - (x - 1) - 1, x / (2 * x) * 3, x % (x % 2 + 1), 2 ** 3 ** x, (2 ** 3) ** x]",
+		"{1, 2} | x => [-x ** 2, (-x) ** 2, -(x * 2), -2 ** x, (-2) ** x, - -x, ~~x, ~(x + 1)]",
+		"{1, 2} | x => [x << 1 << 2, x << (1 << 2), x & 1 | x ^ 2, x & (1 | x) ^ 2, (x | 1) + 1]",
+		"{1, 2} | x => x | 1 | x, y => x | y | x => {} if x | 1 > 2",
+		"{1, 2} | x => [if x > 1 && x < 3 || !(x == 2) then x + 1 else -x, (if x > 1 then 1 else 0) * 2]",
+		"{1, 2} | x, y => x if (x > y || x == y) && !(x > 3 || y > 3) else y if !x > 2",
+		"{1, 2} | x => x + 1 + x, y => x + y > x => x - 1 | :max(1) + :min | (x => x)*3 | split { x => x } {}",
+		"{1, 2, (once x => [x, 0]), {3, (x, y => x)}} | x ~> x if x > 0 | [a, b] <~> a, b + a, b <~ [a, b] | (r), x => x",
+		"r(a, b): {x} <| s, (t) => {{x + a} <| s, {b}, t} where c = a * b",
+		"fn f(x, y) = if x > y then x - y else f(y, x) + min(x, y) ** 2",
+	}
+
+	for _, src := range sources {
+		statements, err := parseStatements(src)
+		if err != nil {
+			t.Errorf("error parsing %q: %v", src, err)
+			continue
+		}
+
+		for _, statement := range statements {
+			printed := ast.Source(statement)
+
+			reparsed, err := parseStatements(printed)
+			if err != nil {
+				t.Errorf("error parsing printed source %q: %v", printed, err)
+				continue
+			}
+			if len(reparsed) != 1 {
+				t.Errorf("printed source %q contains %d statements", printed, len(reparsed))
+				continue
+			}
+
+			// the printed source must parse into the same AST, and print in the same way
+			if expected, actual := fmt.Sprint(statement), fmt.Sprint(reparsed[0]); expected != actual {
+				t.Errorf("printed source %q gives a different AST.\nexpected=%s\ngot=%s", printed, expected, actual)
+			}
+			if again := ast.Source(reparsed[0]); again != printed {
+				t.Errorf("printed source is not canonical. expected=%q, got=%q", printed, again)
+			}
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"max:x,y=>x if x>y", "max: x, y => x if x > y\n"},
+		{"a: x => x; b: x => x\n\n\n{1} | :a", "a: x => x\nb: x => x\n\n{1} | :a\n"},
+		{"// sorting\nmax: x, y => x if (x > y) // the larger\n", "// sorting\nmax: x, y => x if x > y // the larger\n"},
+		{"{1, 2} |\n  // add them\n  x, y => x + y\n", "// add them\n{1, 2} | x, y => x + y\n"},
+		{"a: x => x; b: x => x // both\n/* the\n   end */", "a: x => x\nb: x => x // both\n/* the\n   end */\n"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		actual, err := Format([]byte(test.src), "test.cham")
+		if err != nil {
+			t.Errorf("error formatting %q: %v", test.src, err)
+			continue
+		}
+		if string(actual) != test.expected {
+			t.Errorf("incorrect format for %q. expected=%q, got=%q", test.src, test.expected, actual)
+			continue
+		}
+
+		again, err := Format(actual, "test.cham")
+		if err != nil || string(again) != string(actual) {
+			t.Errorf("formatting %q again gives %q (error %v)", actual, again, err)
+		}
+	}
+
+	if _, err := Format([]byte("{1} | x =>"), "test.cham"); err == nil {
+		t.Errorf("expected error formatting invalid source")
+	}
+}
@@ -9,27 +9,69 @@ import (
 
 // Parses a full program, terminated by EOF
 func (parser *Parser) ParseProgramFully() (*ast.Program, error) {
+	parser.skipSemicolons()
 	program, err := parser.parseProgram(nil)
 	if err != nil {
 		return nil, parser.wrapError(err)
 	}
 
-	_, err = parser.expectToken(token.EOF)
-	if err != nil {
+	if err := parser.expectEnd(); err != nil {
 		return nil, parser.wrapError(err)
 	}
 
 	return program, nil
 }
 
-// Parses a full program or reaction definition, terminated by EOF
-func (parser *Parser) ParseProgramOrReactionDefFully(store *eval.ReactionStore) (*ast.Program, *ast.ReactionPointer, error) {
+// Parses a full program, reaction definition or function definition, terminated by EOF
+func (parser *Parser) ParseProgramOrDefinitionFully(store *eval.ReactionStore) (*ast.Program, ast.Definition, error) {
+	program, def, err := parser.ParseStatement(store)
+	if err != nil {
+		return nil, nil, err
+	}
+	if program == nil && def == nil {
+		return nil, nil, parser.wrapError(errors.New("expected a program or definition but got eof instead"))
+	}
+
+	if err := parser.expectEnd(); err != nil {
+		return nil, nil, parser.wrapError(err)
+	}
+
+	return program, def, nil
+}
+
+// Parses the next statement in the input - a program, reaction definition or function definition.
+// Statements are separated by semicolons (or line breaks, see lexer.NextToken).
+// Returns nil for both the program and the definition when there are no statements left.
+func (parser *Parser) ParseStatement(store *eval.ReactionStore) (*ast.Program, ast.Definition, error) {
 	var program *ast.Program
-	var reaction *ast.ReactionPointer
+	var def ast.Definition
 	var err error
 
-	if parser.currentToken.Type == token.Ident {
-		reaction, err = parser.parseReactionDefinition(store)
+	parser.functions = store != nil
+
+	parser.skipSemicolons()
+	if parser.currentToken.Type == token.EOF {
+		return nil, nil, nil
+	}
+
+	if parser.currentToken.Type == token.Import {
+		def, err = parser.parseImport()
+		if err != nil {
+			return nil, nil, parser.wrapError(err)
+		}
+	} else if parser.currentToken.Type == token.Fn {
+		def, err = parser.parseFunctionDefinition()
+		if err != nil {
+			return nil, nil, parser.wrapError(err)
+		}
+	} else if parser.isNameAhead() && parser.peek(1).Type == token.Assign {
+		program, err = parser.parseNamedProgram(store)
+		if err != nil {
+			return nil, nil, parser.wrapError(err)
+		}
+	} else if parser.currentToken.Type == token.Ident && !parser.isSolutionReferenceAhead() ||
+		parser.isNameAhead() && parser.peek(1).Type == token.ReactionDef {
+		def, err = parser.parseReactionDefinition(store)
 		if err != nil {
 			return nil, nil, parser.wrapError(err)
 		}
@@ -40,20 +82,38 @@ func (parser *Parser) ParseProgramOrReactionDefFully(store *eval.ReactionStore)
 		}
 	}
 
-	_, err = parser.expectToken(token.EOF)
-	if err != nil {
-		return nil, nil, parser.wrapError(err)
+	if parser.currentToken.Type != token.Semicolon && parser.currentToken.Type != token.EOF {
+		return nil, nil, parser.wrapError(errors.Errorf("expected end of statement but got %v instead", parser.currentToken))
+	}
+
+	return program, def, nil
+}
+
+// Skips any semicolons separating statements
+func (parser *Parser) skipSemicolons() {
+	for parser.currentToken.Type == token.Semicolon {
+		parser.next()
 	}
+}
 
-	return program, reaction, nil
+// Expects the end of the input, which may follow some trailing semicolons
+func (parser *Parser) expectEnd() error {
+	parser.skipSemicolons()
+	_, err := parser.expectToken(token.EOF)
+	return err
 }
 
 func (parser *Parser) parseReactionDefinition(store *eval.ReactionStore) (*ast.ReactionPointer, error) {
-	ident, err := parser.parseIdent()
+	ident, err := parser.parseName()
 	if err != nil {
 		return nil, err
 	}
 
+	parameters, err := parser.parseParameters()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing reaction parameters")
+	}
+
 	// expect reaction-def
 	if ok, err := parser.expectToken(token.ReactionDef); !ok {
 		return nil, err
@@ -66,20 +126,85 @@ func (parser *Parser) parseReactionDefinition(store *eval.ReactionStore) (*ast.R
 	}
 
 	return &ast.ReactionPointer{
-		Identifier: ast.Ident(ident),
+		Identifier: ast.Ident(parser.qualify(ident)),
+		Parameters: parameters,
 		Reactions:  reactions,
 	}, nil
 }
 
+// Parses the (optional) parameters of a reaction definition - identifiers separated by commas, enclosed in brackets
+func (parser *Parser) parseParameters() ([]ast.Identifier, error) {
+	if parser.currentToken.Type != token.OpenBracket {
+		return nil, nil
+	}
+	parser.next()
+
+	var parameters []ast.Identifier
+	seen := make(map[ast.Identifier]bool)
+
+	for {
+		name, err := parser.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+
+		ident := ast.Ident(name)
+		if seen[ident] {
+			return nil, errors.Errorf("duplicate parameter %s", name)
+		}
+		seen[ident] = true
+		parameters = append(parameters, ident)
+
+		if parser.currentToken.Type != token.Comma {
+			break
+		}
+		parser.next()
+	}
+
+	if ok, err := parser.expectToken(token.CloseBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	return parameters, nil
+}
+
+// Parses a program, the result of which is stored as a named solution
+func (parser *Parser) parseNamedProgram(store *eval.ReactionStore) (*ast.Program, error) {
+	name, err := parser.parseName()
+	if err != nil {
+		return nil, err
+	}
+
+	if store == nil {
+		return nil, errors.New("named solutions are only supported in repl mode")
+	}
+
+	// expect assign
+	if ok, err := parser.expectToken(token.Assign); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	program, err := parser.parseProgram(store)
+	if err != nil {
+		return nil, err
+	}
+
+	ident := ast.Ident(name)
+	program.Name = &ident
+	return program, nil
+}
+
 func (parser *Parser) parseProgram(store *eval.ReactionStore) (*ast.Program, error) {
-	input, err := parser.parseInput()
+	input, err := parser.parseInput(store)
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing program input")
 	}
 
-	// expect reaction-chain
-	if ok, err := parser.expectToken(token.ReactionChain); !ok {
-		return nil, err
+	// the reaction chain is optional, as the input may contain reaction molecules
+	if parser.currentToken.Type != token.ReactionChain {
+		return &ast.Program{Input: input}, nil
 	}
 	parser.next()
 
@@ -91,62 +216,67 @@ func (parser *Parser) parseProgram(store *eval.ReactionStore) (*ast.Program, err
 	return &ast.Program{Input: input, Reactions: reactions}, nil
 }
 
-func (parser *Parser) parseReactions(store *eval.ReactionStore) ([]*ast.Reaction, error) {
-	var reactions []*ast.Reaction
+func (parser *Parser) parseReactions(store *eval.ReactionStore) ([]ast.Stage, error) {
+	var reactions []ast.Stage
 
-	first, err := parser.parseReactionPointer(store)
+	first, err := parser.parseReactionPriority(store)
 	if err != nil {
-		return nil, errors.Wrap(err, "error parsing program reaction")
-	}
-	for _, r := range first {
-		reactions = append(reactions, r)
+		return nil, err
 	}
+	reactions = append(reactions, first...)
 
 	for parser.currentToken.Type == token.ReactionChain {
 		parser.next()
 
-		reaction, err := parser.parseReactionPointer(store)
+		group, err := parser.parseReactionPriority(store)
 		if err != nil {
-			return nil, errors.Wrap(err, "error parsing program reaction")
-		}
-		for _, r := range reaction {
-			reactions = append(reactions, r)
+			return nil, err
 		}
+		reactions = append(reactions, group...)
 	}
 
 	return reactions, nil
 }
 
-func (parser *Parser) parseInput() ([]ast.IntTuple, error) {
+// Parses the program input - a solution, which may contain nested subsolutions.
+// The input can also be a reference to a named solution.
+func (parser *Parser) parseInput(store *eval.ReactionStore) (*ast.Solution, error) {
+	solution := &ast.Solution{}
+
+	if parser.isSolutionReferenceAhead() {
+		ident, err := parser.parseSolutionReference(store)
+		if err != nil {
+			return nil, err
+		}
+		solution.References = append(solution.References, ident)
+		return solution, nil
+	}
+
 	openCurly, _ := parser.expectToken(token.OpenCurlyBracket)
 	if openCurly {
 		parser.next()
 
-		// if immediately closed, return an empty input slice
+		// if immediately closed, return an empty solution
 		if closeCurly, _ := parser.expectToken(token.CloseCurlyBracket); closeCurly {
 			parser.next()
-			return []ast.IntTuple{}, nil
+			return solution, nil
 		}
 	}
 
-	// otherwise, expect numbers separated by commas
-	var ints []ast.IntTuple
-
-	first, err := parser.parseNumberTuple()
+	// otherwise, expect molecules separated by commas
+	err := parser.parseInputMolecule(solution, store)
 	if err != nil {
 		return nil, err
 	}
-	ints = append(ints, *first)
 
-	// keep accepting more numbers while there are commas
+	// keep accepting more molecules while there are commas
 	for parser.currentToken.Type == token.Comma {
 		parser.next()
 
-		num, err := parser.parseNumberTuple()
+		err := parser.parseInputMolecule(solution, store)
 		if err != nil {
 			return nil, err
 		}
-		ints = append(ints, *num)
 	}
 
 	if openCurly {
@@ -157,5 +287,112 @@ func (parser *Parser) parseInput() ([]ast.IntTuple, error) {
 		parser.next()
 	}
 
-	return ints, nil
+	return solution, nil
+}
+
+// Parses a single molecule of program input (a number tuple or generator, a subsolution or a reaction molecule), and adds it to
+// the solution. The contents of a named solution can also be added.
+func (parser *Parser) parseInputMolecule(solution *ast.Solution, store *eval.ReactionStore) error {
+	if parser.isSolutionReferenceAhead() {
+		ident, err := parser.parseSolutionReference(store)
+		if err != nil {
+			return err
+		}
+		solution.References = append(solution.References, ident)
+		return nil
+	}
+
+	if parser.currentToken.Type == token.OpenBracket {
+		reaction, err := parser.parseReactionMolecule()
+		if err != nil {
+			return err
+		}
+		solution.Reactions = append(solution.Reactions, reaction)
+		return nil
+	}
+
+	if parser.currentToken.Type == token.OpenCurlyBracket {
+		subsolution, err := parser.parseInput(store)
+		if err != nil {
+			return errors.Wrap(err, "error parsing subsolution")
+		}
+		solution.Subsolutions = append(solution.Subsolutions, subsolution)
+		return nil
+	}
+
+	return parser.parseInputTuple(solution)
+}
+
+// Tests whether the current token is the beginning of a reference to a named solution - either $name, or _ for the
+// result of the previous program
+func (parser *Parser) isSolutionReferenceAhead() bool {
+	if parser.currentToken.Type == token.SolutionRef {
+		return true
+	}
+
+	// _ can also be used as the name of a reaction definition
+	return parser.currentToken.Type == token.Ident && parser.currentToken.Literal == "_" &&
+		parser.peek(1).Type != token.ReactionDef && parser.peek(1).Type != token.OpenBracket
+}
+
+// Tests whether the current token is the name of a definition.
+// Keywords are included so that using one as a name gives a helpful error rather than a syntax error.
+func (parser *Parser) isNameAhead() bool {
+	return parser.currentToken.Type == token.Ident || parser.currentToken.Type.IsKeyword()
+}
+
+// Parses a reference to a named solution
+func (parser *Parser) parseSolutionReference(store *eval.ReactionStore) (ast.Identifier, error) {
+	if store == nil {
+		return ast.Identifier{}, errors.New("named solutions are only supported in repl mode")
+	}
+
+	if parser.currentToken.Type == token.SolutionRef {
+		parser.next()
+	}
+
+	name, err := parser.parseName()
+	if err != nil {
+		return ast.Identifier{}, errors.Wrap(err, "error parsing solution name")
+	}
+	return ast.Ident(name), nil
+}
+
+// Parses the definition of a user-defined function, e.g. fn mid(a, b) = (a+b)/2
+func (parser *Parser) parseFunctionDefinition() (*ast.FunctionDefinition, error) {
+	// skip the fn keyword
+	parser.next()
+
+	name, err := parser.parseName()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing function name")
+	}
+	if _, ok := ast.LookupBuiltin(name); ok {
+		return nil, errors.Errorf("cannot redefine built-in function %s", name)
+	}
+	name = parser.qualify(name)
+
+	if ok, err := parser.expectToken(token.OpenBracket); !ok {
+		return nil, err
+	}
+	parameters, err := parser.parseParameters()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing function parameters")
+	}
+
+	if ok, err := parser.expectToken(token.Assign); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	body, err := parser.parseAexp()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing function body")
+	}
+
+	return &ast.FunctionDefinition{
+		Identifier: ast.Ident(name),
+		Parameters: parameters,
+		Body:       body,
+	}, nil
 }
@@ -7,43 +7,255 @@ import (
 	"github.com/pkg/errors"
 )
 
-func (parser *Parser) parseReactionPointer(store *eval.ReactionStore) ([]*ast.Reaction, error) {
-	if parser.currentToken.Type == token.ReactionDef {
+// Parses reaction groups composed by priority
+// <reaction-priority> ::= <reaction-group> {<priority-op> <reaction-group>}
+func (parser *Parser) parseReactionPriority(store *eval.ReactionStore) ([]ast.Stage, error) {
+	first, err := parser.parseReactionGroup(store)
+	if err != nil {
+		return nil, err
+	}
+
+	// if there is no priority composition, just return the stage(s) as-is
+	if parser.currentToken.Type != token.GreaterThan {
+		return first, nil
+	}
+
+	root, err := toPriorityGroup(first)
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.currentToken.Type == token.GreaterThan {
+		parser.next()
+
+		stages, err := parser.parseReactionGroup(store)
+		if err != nil {
+			return nil, err
+		}
+
+		group, err := toPriorityGroup(stages)
+		if err != nil {
+			return nil, err
+		}
+
+		// append the group to the end of the fallback chain
+		last := root
+		for last.Fallback != nil {
+			last = last.Fallback
+		}
+		last.Fallback = group
+	}
+
+	return []ast.Stage{root}, nil
+}
+
+// Converts the stage(s) from a (parsed) reaction group into a new group which can be used in a priority chain.
+func toPriorityGroup(stages []ast.Stage) (*ast.ReactionGroup, error) {
+	if len(stages) == 1 {
+		if group, ok := stages[0].(*ast.ReactionGroup); ok {
+			// copy the whole group, as it may be shared with another part of the program
+			return group.Copy(), nil
+		}
+	}
+
+	group := &ast.ReactionGroup{}
+	if err := addToGroup(group, stages); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// Parses a group of reaction pointers composed in parallel
+// <reaction-group> ::= <reaction-pointer> {<parallel-op> <reaction-pointer>}
+func (parser *Parser) parseReactionGroup(store *eval.ReactionStore) ([]ast.Stage, error) {
+	first, err := parser.parseReactionPointer(store)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing program reaction")
+	}
+
+	// if there is no parallel composition, just return the stage(s) as-is
+	if parser.currentToken.Type != token.Plus {
+		return first, nil
+	}
+
+	group := &ast.ReactionGroup{}
+	if err := addToGroup(group, first); err != nil {
+		return nil, err
+	}
+
+	for parser.currentToken.Type == token.Plus {
+		parser.next()
+
+		reaction, err := parser.parseReactionPointer(store)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing program reaction")
+		}
+		if err := addToGroup(group, reaction); err != nil {
+			return nil, err
+		}
+	}
+
+	return []ast.Stage{group}, nil
+}
+
+// Adds the reactions from a (parsed) reaction pointer to a parallel group
+func addToGroup(group *ast.ReactionGroup, stages []ast.Stage) error {
+	if len(stages) != 1 {
+		return errors.New("a chain of reactions cannot be composed in parallel")
+	}
+	return group.Add(stages[0])
+}
+
+func (parser *Parser) parseReactionPointer(store *eval.ReactionStore) ([]ast.Stage, error) {
+	if parser.isLoopAhead() {
+		loop, err := parser.parseLoop(store)
+		if err != nil {
+			return nil, err
+		}
+		return []ast.Stage{loop}, nil
+	} else if parser.currentToken.Type == token.Split {
+		branch, err := parser.parseBranch(store)
+		if err != nil {
+			return nil, err
+		}
+		return []ast.Stage{branch}, nil
+	} else if parser.currentToken.Type == token.ReactionDef {
 		if store == nil {
 			return nil, errors.New("reaction defs are only supported in repl mode")
 		}
 
 		parser.next()
-		ident, err := parser.parseIdent()
+		name, err := parser.parseName()
 		if err != nil {
 			return nil, errors.Wrap(err, "error parsing reaction ident")
 		}
+		ident, fallback := parser.qualifyReference(name)
 
-		reactions, err := store.Get(ast.Ident(ident))
+		args, err := parser.parseArguments()
 		if err != nil {
-			return nil, errors.Wrap(err, "error parsing reaction from def")
+			return nil, errors.Wrap(err, "error parsing reaction arguments")
 		}
+		ref := &ast.ReactionReference{Identifier: ident, Arguments: args, Fallback: fallback}
 
-		return reactions, nil
+		// The reference is resolved when the program is evaluated, as the definition may change (or not exist yet).
+		// If it is already defined, the arguments can be checked now.
+		if def, err := store.GetReference(ref); err == nil && len(args) != len(def.Parameters) {
+			return nil, errors.Errorf("reaction %s expects %d argument(s) but got %d", ident.Name(), len(def.Parameters), len(args))
+		}
+
+		return []ast.Stage{ref}, nil
 	} else {
 		reaction, err := parser.parseReaction()
 		if err != nil {
 			return nil, err
 		}
-		return []*ast.Reaction{reaction}, nil
+		return []ast.Stage{reaction}, nil
+	}
+}
+
+// Parses the (optional) arguments of a reaction pointer - arithmetic expressions separated by commas,
+// enclosed in brackets
+func (parser *Parser) parseArguments() ([]ast.IntegerTerm, error) {
+	if parser.currentToken.Type != token.OpenBracket {
+		return nil, nil
+	}
+	parser.next()
+
+	var args []ast.IntegerTerm
+	for {
+		arg, err := parser.parseAexp()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if parser.currentToken.Type != token.Comma {
+			break
+		}
+		parser.next()
+	}
+
+	if ok, err := parser.expectToken(token.CloseBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	return args, nil
+}
+
+// Tests whether the tokens starting n places ahead of the current token are the beginning of a stage - a reaction,
+// reaction reference, loop or branch.
+// This is used to tell apart the reaction chain operator from a bitwise 'or' at the end of a reaction.
+func (parser *Parser) isStageAhead(n int) bool {
+	switch parser.peek(n).Type {
+	case token.Split:
+		return true
+	case token.OpenBracket:
+		// a reaction can start with a reaction pattern, e.g. (r) => {}, otherwise the bracket starts a loop
+		if parser.peek(n+1).Type == token.Ident && parser.peek(n+2).Type == token.CloseBracket {
+			return parser.isReactionAhead(n)
+		}
+		return parser.isStageAhead(n + 1)
 	}
+	return parser.isReactionAhead(n)
 }
 
-func (parser *Parser) parseReaction() (*ast.Reaction, error) {
+// Tests whether the tokens starting n places ahead of the current token
+// are the beginning of a reaction pointer.
+// This is used to tell apart the parallel composition operator from an
+// arithmetic 'plus' at the end of a reaction.
+func (parser *Parser) isReactionAhead(n int) bool {
+	if parser.peek(n).Type == token.ReactionDef {
+		return true
+	}
+
+	// skip over the reaction input, and check that it is followed by a reaction-op (or structural rule op).
+	// Any brackets must be balanced, otherwise the tokens are the end of an enclosing branch or tuple.
+	depth := 0
+	for ; ; n++ {
+		switch parser.peek(n).Type {
+		case token.ReactionOp, token.HeatingOp, token.CoolingOp, token.ReversibleOp:
+			return depth == 0
+		case token.Ident, token.Comma, token.AirlockOp:
+			continue
+		case token.OpenSquareBracket, token.OpenCurlyBracket:
+			depth++
+		case token.CloseSquareBracket, token.CloseCurlyBracket:
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case token.OpenBracket:
+			// skip over a reaction pattern, e.g. (r)
+			if parser.peek(n+1).Type != token.Ident || parser.peek(n+2).Type != token.CloseBracket {
+				return false
+			}
+			n += 2
+		default:
+			return false
+		}
+	}
+}
+
+// Parses a reaction, or a structural (heating/cooling) rule
+func (parser *Parser) parseReaction() (ast.Stage, error) {
 	// parse input
 	input, err := parser.parseReactionInput()
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing reaction input")
 	}
 
-	// expect reaction-op
-	if ok, err := parser.expectToken(token.ReactionOp); !ok {
-		return nil, err
+	kind := ast.ReactionRule
+	switch parser.currentToken.Type {
+	case token.CoolingOp, token.ReversibleOp:
+		return parser.parseStructuralRule(input)
+	case token.HeatingOp:
+		kind = ast.HeatingRule
+	default:
+		// expect reaction-op
+		if ok, err := parser.expectToken(token.ReactionOp); !ok {
+			return nil, err
+		}
 	}
 	parser.next()
 
@@ -52,41 +264,191 @@ func (parser *Parser) parseReaction() (*ast.Reaction, error) {
 		return nil, errors.Wrap(err, "error parsing reaction action")
 	}
 
+	guarded := parser.currentToken.Type == token.If
 	condition, err := parser.parseReactionCondition()
 	if err != nil {
 		return nil, errors.Wrap(err, "error parsing reaction condition")
 	}
 
+	alternatives, err := parser.parseReactionAlternatives(guarded)
+	if err != nil {
+		return nil, err
+	}
+
+	locals, err := parser.parseLocalBindings(input)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing local variables")
+	}
+
 	return &ast.Reaction{
-		Input:     input,
-		Action:    action,
-		Condition: condition,
+		Kind:         kind,
+		Input:        input,
+		Action:       action,
+		Condition:    condition,
+		Alternatives: alternatives,
+		Locals:       locals,
 	}, nil
 }
 
+// Parses the (optional) local variables of a reaction - 'where' followed by bindings separated by commas,
+// e.g. where m = (x+y)/2, n = m+1
+func (parser *Parser) parseLocalBindings(input *ast.ReactionInput) ([]*ast.LocalBinding, error) {
+	if parser.currentToken.Type != token.Where {
+		return nil, nil
+	}
+	parser.next()
+
+	bound := make(map[ast.Identifier]bool)
+	for _, ident := range ast.BoundIdentifiers(input.Patterns) {
+		bound[ident] = true
+	}
+
+	var locals []*ast.LocalBinding
+	for {
+		name, err := parser.parseIdent()
+		if err != nil {
+			return nil, err
+		}
+
+		ident := ast.Ident(name)
+		if bound[ident] {
+			return nil, errors.Errorf("%s is already bound", name)
+		}
+		bound[ident] = true
+
+		if ok, err := parser.expectToken(token.Assign); !ok {
+			return nil, err
+		}
+		parser.next()
+
+		value, err := parser.parseAexp()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing value of %s", name)
+		}
+		locals = append(locals, &ast.LocalBinding{Identifier: ident, Value: value})
+
+		if parser.currentToken.Type != token.Comma {
+			break
+		}
+		parser.next()
+	}
+
+	return locals, nil
+}
+
+// Parses the alternative outcomes of a reaction, each of which follows 'else'.
+// An alternative can only follow an outcome which has a condition, as otherwise it would never take place.
+func (parser *Parser) parseReactionAlternatives(guarded bool) ([]*ast.ReactionAlternative, error) {
+	var alternatives []*ast.ReactionAlternative
+
+	for parser.currentToken.Type == token.Else {
+		if !guarded {
+			return nil, errors.New("an alternative cannot follow an outcome without a condition")
+		}
+		parser.next()
+
+		action, err := parser.parseReactionAction()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing alternative reaction action")
+		}
+
+		guarded = parser.currentToken.Type == token.If
+		condition, err := parser.parseReactionCondition()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing alternative reaction condition")
+		}
+
+		alternatives = append(alternatives, &ast.ReactionAlternative{Action: action, Condition: condition})
+	}
+
+	return alternatives, nil
+}
+
 func (parser *Parser) parseReactionInput() (*ast.ReactionInput, error) {
-	var identifiers []ast.IdentifierTuple
+	patterns, err := parser.parsePatterns()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.ReactionInput{Patterns: patterns}, nil
+}
+
+// Parses one or more patterns separated by commas
+func (parser *Parser) parsePatterns() ([]ast.Pattern, error) {
+	var patterns []ast.Pattern
 
-	first, err := parser.parseIdentTuple()
+	first, err := parser.parsePattern()
 	if err != nil {
 		return nil, err
 	}
-	identifiers = append(identifiers, *first)
+	patterns = append(patterns, first)
 
-	// keep accepting more identifiers while there are commas
+	// keep accepting more patterns while there are commas
 	for parser.currentToken.Type == token.Comma {
 		parser.next()
 
+		pattern, err := parser.parsePattern()
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// Parses a pattern, which may be followed by an airlock
+func (parser *Parser) parsePattern() (ast.Pattern, error) {
+	pattern, err := parser.parseMoleculePattern()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.currentToken.Type != token.AirlockOp {
+		return pattern, nil
+	}
+	parser.next()
+
+	solution, err := parser.parseIdent()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing airlock solution identifier")
+	}
+
+	return &ast.AirlockPattern{Pattern: pattern, Solution: ast.Ident(solution)}, nil
+}
+
+// Parses a molecule pattern - either an identifier tuple, a subsolution pattern or a reaction pattern
+func (parser *Parser) parseMoleculePattern() (ast.Pattern, error) {
+	if parser.currentToken.Type == token.OpenBracket {
+		return parser.parseReactionPattern()
+	}
+
+	if parser.currentToken.Type != token.OpenCurlyBracket {
 		ident, err := parser.parseIdentTuple()
 		if err != nil {
 			return nil, err
 		}
+		return *ident, nil
+	}
+	parser.next()
 
-		// append the identifier to the slice and advance the parser
-		identifiers = append(identifiers, *ident)
+	// if immediately closed, the pattern matches an empty subsolution
+	if closeCurly, _ := parser.expectToken(token.CloseCurlyBracket); closeCurly {
+		parser.next()
+		return &ast.SolutionPattern{Patterns: []ast.Pattern{}}, nil
+	}
+
+	patterns, err := parser.parsePatterns()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing subsolution pattern")
+	}
+
+	if ok, err := parser.expectToken(token.CloseCurlyBracket); !ok {
+		return nil, err
 	}
+	parser.next()
 
-	return &ast.ReactionInput{Idents: identifiers}, nil
+	return &ast.SolutionPattern{Patterns: patterns}, nil
 }
 
 func (parser *Parser) parseReactionAction() (*ast.ReactionAction, error) {
@@ -97,39 +459,103 @@ func (parser *Parser) parseReactionAction() (*ast.ReactionAction, error) {
 		// if immediately closed, return an empty products slice
 		if closeCurly, _ := parser.expectToken(token.CloseCurlyBracket); closeCurly {
 			parser.next()
-			return &ast.ReactionAction{Products: []ast.IntegerTermTuple{}}, nil
+			return &ast.ReactionAction{Products: []ast.Product{}}, nil
 		}
 	}
 
-	// otherwise, expect aexps separated by commas
-	var aexps []ast.IntegerTermTuple
+	// otherwise, expect products separated by commas
+	products, err := parser.parseProducts()
+	if err != nil {
+		return nil, err
+	}
 
-	first, err := parser.parseAexpTuple()
+	if openCurly {
+		ok, err := parser.expectToken(token.CloseCurlyBracket)
+		if !ok {
+			return nil, err
+		}
+		parser.next()
+	}
+
+	return &ast.ReactionAction{Products: products}, nil
+}
+
+// Parses one or more products separated by commas
+func (parser *Parser) parseProducts() ([]ast.Product, error) {
+	var products []ast.Product
+
+	first, err := parser.parseProduct()
 	if err != nil {
 		return nil, err
 	}
-	aexps = append(aexps, *first)
+	products = append(products, first)
 
-	// keep accepting more aexps while there are commas
+	// keep accepting more products while there are commas
 	for parser.currentToken.Type == token.Comma {
 		parser.next()
 
-		aexp, err := parser.parseAexpTuple()
+		product, err := parser.parseProduct()
 		if err != nil {
 			return nil, err
 		}
-		aexps = append(aexps, *aexp)
+		products = append(products, product)
 	}
 
-	if openCurly {
-		ok, err := parser.expectToken(token.CloseCurlyBracket)
-		if !ok {
+	return products, nil
+}
+
+// Parses a product, which may be followed by an airlock
+func (parser *Parser) parseProduct() (ast.Product, error) {
+	product, err := parser.parseMoleculeProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	if parser.currentToken.Type != token.AirlockOp {
+		return product, nil
+	}
+	parser.next()
+
+	solution, err := parser.parseIdent()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing airlock solution identifier")
+	}
+
+	return &ast.AirlockProduct{Product: product, Solution: ast.Ident(solution)}, nil
+}
+
+// Parses a molecule product - either an aexp tuple, a subsolution product or a reaction molecule
+func (parser *Parser) parseMoleculeProduct() (ast.Product, error) {
+	if parser.isReactionMoleculeAhead() {
+		return parser.parseReactionMolecule()
+	}
+
+	if parser.currentToken.Type != token.OpenCurlyBracket {
+		aexp, err := parser.parseAexpTuple()
+		if err != nil {
 			return nil, err
 		}
+		return *aexp, nil
+	}
+	parser.next()
+
+	// if immediately closed, the product is an empty subsolution
+	if closeCurly, _ := parser.expectToken(token.CloseCurlyBracket); closeCurly {
 		parser.next()
+		return &ast.SolutionProduct{Products: []ast.Product{}}, nil
 	}
 
-	return &ast.ReactionAction{Products: aexps}, nil
+	products, err := parser.parseProducts()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing subsolution product")
+	}
+
+	if ok, err := parser.expectToken(token.CloseCurlyBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	return &ast.SolutionProduct{Products: products}, nil
 }
 
 func (parser *Parser) parseReactionCondition() (*ast.ReactionCondition, error) {
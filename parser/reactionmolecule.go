@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/token"
+	"github.com/pkg/errors"
+)
+
+// reactionmolecule.go contains the parsing code for reaction molecules (higher-order reactions).
+//
+// A reaction molecule is a reaction enclosed in brackets, which can be placed in the program input or created as a
+// reaction product:
+//   (x, y => x+y)         a reaction which stays in the solution after taking place
+//   (once x => x*2)       a reaction which is consumed when it takes place
+// A reaction molecule can be matched in a reaction input by an identifier enclosed in brackets, e.g. (r).
+
+// Parses a reaction molecule
+func (parser *Parser) parseReactionMolecule() (*ast.Reaction, error) {
+	if ok, err := parser.expectToken(token.OpenBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	once := parser.currentToken.Type == token.Once
+	if once {
+		parser.next()
+	}
+
+	stage, err := parser.parseReaction()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing reaction molecule")
+	}
+
+	reaction, ok := stage.(*ast.Reaction)
+	if !ok || reaction.Kind != ast.ReactionRule {
+		return nil, errors.New("a reaction molecule cannot be a structural rule")
+	}
+	reaction.Once = once
+
+	if ok, err := parser.expectToken(token.CloseBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	return reaction, nil
+}
+
+// Tests whether the current token is the beginning of a reaction molecule.
+// This is used to tell apart a reaction molecule from a bracketed arithmetic expression in the reaction products.
+func (parser *Parser) isReactionMoleculeAhead() bool {
+	return parser.currentToken.Type == token.OpenBracket &&
+		(parser.peek(1).Type == token.Once || parser.isReactionAhead(1))
+}
+
+// Parses a reaction pattern - an identifier enclosed in brackets
+func (parser *Parser) parseReactionPattern() (*ast.ReactionPattern, error) {
+	if ok, err := parser.expectToken(token.OpenBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	ident, err := parser.parseIdent()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing reaction pattern")
+	}
+
+	if ok, err := parser.expectToken(token.CloseBracket); !ok {
+		return nil, err
+	}
+	parser.next()
+
+	return &ast.ReactionPattern{Identifier: ast.Ident(ident)}, nil
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/token"
+	"github.com/pkg/errors"
+)
+
+// structural.go contains the parsing code for the structural rules of the chemical abstract machine.
+//
+// Following the notation of Berry & Boudol, structural rules are written with the 'cool' molecules on the left and
+// the 'heated' molecules on the right:
+//   S ~> S'    (or S ⇀ S')   heats S into S'
+//   S <~ S'    (or S ↽ S')   cools S' into S
+//   S <~> S'   (or S ⇌ S')   both of the above
+//
+// Heating rules are parsed in the same way as reactions. For cooling and reversible rules, both sides are patterns.
+
+// Parses the rest of a cooling or reversible rule, following the (cooled) reaction input
+func (parser *Parser) parseStructuralRule(cooled *ast.ReactionInput) (ast.Stage, error) {
+	reversible := parser.currentToken.Type == token.ReversibleOp
+	parser.next()
+
+	heated, err := parser.parseReactionInput()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing structural rule input")
+	}
+
+	condition, err := parser.parseReactionCondition()
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing reaction condition")
+	}
+
+	cooledProducts, err := toProducts(cooled.Patterns)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing cooling rule")
+	}
+	cooling := &ast.Reaction{
+		Kind:      ast.CoolingRule,
+		Input:     heated,
+		Action:    &ast.ReactionAction{Products: cooledProducts},
+		Condition: condition,
+	}
+
+	if !reversible {
+		return cooling, nil
+	}
+
+	heatedProducts, err := toProducts(heated.Patterns)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing heating rule")
+	}
+	heating := &ast.Reaction{
+		Kind:      ast.HeatingRule,
+		Input:     cooled,
+		Action:    &ast.ReactionAction{Products: heatedProducts},
+		Condition: condition,
+	}
+
+	return &ast.ReactionGroup{Reactions: []*ast.Reaction{heating, cooling}}, nil
+}
+
+// Converts patterns into the products which recreate the molecules they match
+func toProducts(patterns []ast.Pattern) ([]ast.Product, error) {
+	products := make([]ast.Product, 0, len(patterns))
+	for _, pattern := range patterns {
+		product, err := toProduct(pattern)
+		if err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+	return products, nil
+}
+
+// Converts a pattern into the product which recreates the molecule it matches.
+// A reaction molecule can't be recreated, so a reaction pattern (r) is an error.
+func toProduct(pattern ast.Pattern) (ast.Product, error) {
+	switch pattern := pattern.(type) {
+	case ast.IdentifierTuple:
+		values := make([]ast.IntegerTerm, 0, pattern.Dimensions())
+		for _, ident := range pattern.Values {
+			values = append(values, ident)
+		}
+		return ast.IntegerTermTuple{Values: values}, nil
+	case *ast.SolutionPattern:
+		products, err := toProducts(pattern.Patterns)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.SolutionProduct{Products: products}, nil
+	case *ast.AirlockPattern:
+		product, err := toProduct(pattern.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		return &ast.AirlockProduct{Product: product, Solution: pattern.Solution}, nil
+	default:
+		return nil, errors.Errorf("the molecule matched by %s cannot be recreated by a structural rule", ast.Source(pattern))
+	}
+}
@@ -2,13 +2,13 @@ package repl
 
 import (
 	"fmt"
-	"github.com/howden/cham/eval"
+	"os"
 	"strings"
 )
 
 func HandleCommandLine(args []string) {
 	if len(args) < 2 {
-		StartRepl()
+		StartRepl("")
 	} else if args[1] == "-h" || args[1] == "-help" || args[1] == "-version" {
 		PrintHelp()
 	} else if args[1] == "-f" || args[1] == "-file" {
@@ -16,12 +16,30 @@ func HandleCommandLine(args []string) {
 			PrintHelp()
 		} else {
 			path := args[2]
-			lines, err := readLines(path)
+			src, err := readFile(path)
 			if err != nil {
 				fmt.Printf("error reading from file: %s\n", err)
 				return
 			}
-			HandleFileInput(lines, eval.NewReactionStore())
+			HandleFileInput(src, path, newStore())
+		}
+	} else if args[1] == "-s" || args[1] == "-session" {
+		if len(args) < 3 {
+			PrintHelp()
+		} else {
+			StartRepl(args[2])
+		}
+	} else if args[1] == "fmt" {
+		if len(args) < 3 {
+			PrintHelp()
+		} else if !FormatFiles(args[2:]) {
+			os.Exit(1)
+		}
+	} else if args[1] == "doctest" {
+		if len(args) < 3 {
+			PrintHelp()
+		} else if !RunDoctest(args[2]) {
+			os.Exit(1)
 		}
 	} else if args[1] == "-l" {
 		if len(args) < 3 {
@@ -30,6 +48,13 @@ func HandleCommandLine(args []string) {
 			program := strings.Join(args[2:], " ")
 			PrintLexerOutput(program)
 		}
+	} else if args[1] == "-t" {
+		if len(args) < 3 {
+			PrintHelp()
+		} else {
+			program := strings.Join(args[2:], " ")
+			PrintTraceOutput(program)
+		}
 	} else if args[1] == "-p" {
 		if len(args) < 3 {
 			PrintHelp()
@@ -49,16 +74,34 @@ func PrintHelp() {
   COMMANDS
     cham               Starts the REPL
     cham -h            Prints the help menu
+    cham -s <file>     Starts the REPL, restoring the session saved in the
+                       given file, and saving the session to it after each
+                       input
     cham '<prog>'      Runs the given program and prints the output
     cham -f <file>     Loads and runs a program from the given file and
                        prints the output
+    cham fmt <file>... Rewrites the given files in the canonical format, with
+                       one statement per line and only the brackets that
+                       are needed
+    cham doctest <file.md>
+                       Runs the example programs in the given markdown file,
+                       and reports any whose output doesn't match
     cham -l '<prog>'   Runs the given program through the lexer and prints
                        the output
     cham -p '<prog>'   Runs the given program through the parser and prints
                        the output
+    cham -t '<prog>'   Runs the given program and prints each step taken
+                       during evaluation, followed by the output
 
   REPL USAGE
     Enter a program into the prompt, then press enter to evaluate it.
+    Several programs can be entered at once, separated by semicolons. If a
+    program continues onto the next line (it ends with '|' or has unclosed
+    brackets), the rest can be entered at the '|' prompt.
+    Definitions from another file can be imported into a namespace using
+    import "<file>" as <name>, then used as :<name>.<definition>.
+    The sample programs (docs/programs.txt) are available as the standard
+    library, e.g. :max and :sort.
     A red cross is displayed at the prompt for invalid input. A green tick is
     displayed for valid input.
 
@@ -67,7 +110,10 @@ func PrintHelp() {
   REPL COMMANDS
     :quit   :q    quit the REPL
     :load   :l    loads programs from the given file (provided as an argument)
-    :store  :s    view a list of reactions saved in the REPLs memory
+    :save         saves the definitions and solutions in the REPLs memory to the given file, as
+                  source code which can be loaded again using :load
+    :store  :s    view a list of reactions, functions, modules and solutions saved in the REPLs memory
+    :trace  :t    toggles printing each step taken while evaluating programs
 
 `)
 }
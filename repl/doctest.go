@@ -0,0 +1,242 @@
+package repl
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/lexer"
+	"github.com/howden/cham/parser"
+	"sort"
+	"strings"
+)
+
+// doctest.go contains the doc-test runner, which checks the example programs in a markdown file.
+//
+// The code blocks of the file are run in order, against the same store. A code block which contains lines starting
+// with the REPL prompt ('> ') holds examples: each prompt line is run, and its output is compared against the lines
+// which follow it (up to the next prompt). Any other code block holds definitions, which are loaded into the store.
+// Code blocks can be inside a quote, and code blocks marked as another language (e.g. ```bash) are skipped.
+//
+// Results are compared as multisets, so the order of the molecules doesn't matter.
+
+// A code block in a markdown file
+type codeBlock struct {
+	line  int
+	lines []string
+}
+
+// An example in a code block - the input entered at the prompt, and the expected output
+type example struct {
+	line     int
+	input    string
+	expected []string
+}
+
+// Runs the examples in the markdown file at the given path, printing any which fail.
+// Returns whether all of the examples passed, and all of the definitions were loaded.
+func RunDoctest(path string) bool {
+	src, err := readFile(path)
+	if err != nil {
+		fmt.Printf("error reading from file: %s\n", err)
+		return false
+	}
+
+	store := newStore()
+	passed, failed := 0, 0
+	for _, block := range codeBlocks(src) {
+		examples := blockExamples(block)
+		if examples == nil {
+			// definitions
+			if _, err := runExample(strings.Join(block.lines, "\n"), path, store); err != nil {
+				fmt.Printf("%s:%d: error loading definitions: %s\n", path, block.line, err)
+				failed++
+			}
+			continue
+		}
+
+		for _, ex := range examples {
+			output, err := runExample(ex.input, path, store)
+			if err != nil {
+				output = []string{fmt.Sprintf("error: %s", err)}
+			}
+
+			if !outputMatches(ex.expected, output) {
+				fmt.Printf("%s:%d: > %s\n  expected: %s\n  got:      %s\n", path, ex.line, ex.input,
+					strings.Join(ex.expected, "\n            "), strings.Join(output, "\n            "))
+				failed++
+			} else {
+				passed++
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	return failed == 0
+}
+
+// Returns the code blocks in a markdown file.
+// A quoted code block has the quote markers removed from each of its lines.
+func codeBlocks(src string) []codeBlock {
+	var blocks []codeBlock
+	var current *codeBlock
+	quoted, skipped := false, false
+
+	for i, line := range strings.Split(src, "\n") {
+		if current == nil {
+			text := strings.TrimSpace(line)
+			quoted = strings.HasPrefix(text, ">")
+			if quoted {
+				text = strings.TrimSpace(unquote(text))
+			}
+
+			if strings.HasPrefix(text, "```") {
+				// only unmarked code blocks (or those marked as cham) contain programs
+				lang := strings.TrimSpace(strings.TrimPrefix(text, "```"))
+				skipped = lang != "" && lang != "cham"
+				current = &codeBlock{line: i + 2}
+			}
+			continue
+		}
+
+		if quoted {
+			line = unquote(strings.TrimSpace(line))
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if !skipped {
+				blocks = append(blocks, *current)
+			}
+			current = nil
+			continue
+		}
+		current.lines = append(current.lines, line)
+	}
+	return blocks
+}
+
+// Removes the quote marker ('>' followed by an optional space) from the start of a line
+func unquote(line string) string {
+	line = strings.TrimPrefix(line, ">")
+	return strings.TrimPrefix(line, " ")
+}
+
+// Returns the examples in a code block, or nil if it doesn't contain any (so it contains definitions)
+func blockExamples(block codeBlock) []*example {
+	var examples []*example
+	for i, line := range block.lines {
+		if strings.HasPrefix(line, "> ") {
+			examples = append(examples, &example{line: block.line + i, input: strings.TrimPrefix(line, "> ")})
+		} else if len(examples) > 0 && strings.TrimSpace(line) != "" {
+			last := examples[len(examples)-1]
+			last.expected = append(last.expected, strings.TrimSpace(line))
+		}
+	}
+	return examples
+}
+
+// Runs the statements entered at the prompt, returning the output the REPL would print for each of them - the
+// result of a program, or OK for a definition.
+// The path is used to resolve imports.
+func runExample(src string, path string, store *eval.ReactionStore) ([]string, error) {
+	var output []string
+
+	p := parser.NewParser(lexer.FromString(src))
+	for {
+		program, def, err := p.ParseStatement(store)
+		if err != nil {
+			return nil, err
+		}
+
+		if program != nil {
+			result, err := (&eval.Evaluator{Store: store}).Evaluate(program)
+			if err != nil {
+				return nil, err
+			}
+			storeResult(program, result, store)
+			output = append(output, result.String())
+		} else if imp, ok := def.(*ast.Import); ok {
+			if err := parser.Import(imp, path, store); err != nil {
+				return nil, err
+			}
+			output = append(output, "OK")
+		} else if def != nil {
+			store.Define(def)
+			output = append(output, "OK")
+		} else {
+			return output, nil
+		}
+	}
+}
+
+// Tests whether the output of an example matches the expected output.
+// Results are compared as multisets, and anything else must match exactly.
+func outputMatches(expected []string, output []string) bool {
+	if len(expected) != len(output) {
+		return false
+	}
+	for i := range expected {
+		if normaliseResult(expected[i]) != normaliseResult(output[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Sorts the molecules in a printed result (e.g. [3 1 [0 2] {5 4}]), including those in subsolutions, so that results
+// with the same molecules are the same. Anything which isn't a result is returned unchanged.
+func normaliseResult(s string) string {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return s
+	}
+	molecules, ok := splitMolecules(s[1 : len(s)-1])
+	if !ok {
+		return s
+	}
+	return "[" + strings.Join(molecules, " ") + "]"
+}
+
+// Splits the molecules of a result, which are separated by spaces, and sorts them.
+// Returns false if the brackets aren't balanced.
+func splitMolecules(s string) ([]string, bool) {
+	var molecules []string
+	depth, start := 0, 0
+
+	add := func(molecule string) bool {
+		if molecule == "" {
+			return true
+		}
+		// the contents of a subsolution are a multiset too, whereas the values of a tuple are in order
+		if strings.HasPrefix(molecule, "{") {
+			inner, ok := splitMolecules(molecule[1 : len(molecule)-1])
+			if !ok {
+				return false
+			}
+			molecule = "{" + strings.Join(inner, " ") + "}"
+		}
+		molecules = append(molecules, molecule)
+		return true
+	}
+
+	for i, ch := range s {
+		switch ch {
+		case '[', '{', '(':
+			depth++
+		case ']', '}', ')':
+			if depth--; depth < 0 {
+				return nil, false
+			}
+		case ' ':
+			if depth == 0 {
+				if !add(s[start:i]) {
+					return nil, false
+				}
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 || !add(s[start:]) {
+		return nil, false
+	}
+
+	sort.Strings(molecules)
+	return molecules, true
+}
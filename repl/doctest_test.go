@@ -0,0 +1,51 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormaliseResult(t *testing.T) {
+	tests := map[string]string{
+		"[3 1 2]":             "[1 2 3]",
+		"[[1 2] 3 [0 4]]":     "[3 [0 4] [1 2]]",
+		"[{5 4} {2 {1 0}} 3]": "[3 {2 {0 1}} {4 5}]",
+		"[]":                  "[]",
+		"OK":                  "OK",
+		"[1 [2]":              "[1 [2]",
+	}
+
+	for src, expected := range tests {
+		if actual := normaliseResult(src); actual != expected {
+			t.Errorf("incorrect result for %q. expected=%s, got=%s", src, expected, actual)
+		}
+	}
+}
+
+func TestDoctest(t *testing.T) {
+	if !RunDoctest(filepath.Join("..", "docs", "programs.md")) {
+		t.Errorf("expected the examples in programs.md to pass")
+	}
+
+	tests := map[string]bool{
+		"```\nmy_max: x,y => x if x>y\n```\n> ```\n> > {1,7,3} | :my_max\n> [7]\n> ```": true,
+		"```\n> {3,1,2} | x => [x, 0]\n[[2 0] [1 0] [3 0]]\n> f: x => x\nOK\n```":       true,
+		"```\n> {1,7,3} | :max\n[3]\n```":                                               false,
+		"```\n> {1,7,3} | :undefined\n[7]\n```":                                         false,
+		"```\nbroken: x =>\n```":                                                        false,
+		"```bash\n> {1,7,3} | :max\n[3]\n```":                                           true,
+	}
+
+	dir := t.TempDir()
+	for src, expected := range tests {
+		path := filepath.Join(dir, "test.md")
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if actual := RunDoctest(path); actual != expected {
+			t.Errorf("incorrect result for %q. expected=%v, got=%v", src, expected, actual)
+		}
+	}
+}
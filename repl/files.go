@@ -1,22 +1,48 @@
 package repl
 
 import (
-	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/howden/cham/parser"
 	"os"
 )
 
-// Reads all lines from a given file path
-func readLines(path string) ([]string, error) {
-	file, err := os.Open(path)
+// Reads the contents of the file at the given path
+func readFile(path string) (string, error) {
+	bytes, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer file.Close()
+	return string(bytes), nil
+}
+
+// Rewrites each of the files in the canonical format (see parser.Format).
+// A file is left unchanged if it can't be parsed. Returns whether all the files were formatted.
+func FormatFiles(paths []string) bool {
+	ok := true
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("error reading from file: %s\n", err)
+			ok = false
+			continue
+		}
+
+		formatted, err := parser.Format(src, path)
+		if err != nil {
+			fmt.Printf("error formatting %s:\n", path)
+			parser.PrintParserError(string(src), err)
+			ok = false
+			continue
+		}
 
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
+		if bytes.Equal(src, formatted) {
+			continue
+		}
+		if err := os.WriteFile(path, formatted, 0644); err != nil {
+			fmt.Printf("error writing to file: %s\n", err)
+			ok = false
+		}
 	}
-	return lines, scanner.Err()
+	return ok
 }
@@ -6,49 +6,115 @@ import (
 	"github.com/howden/cham/eval"
 	"github.com/howden/cham/lexer"
 	"github.com/howden/cham/parser"
+	"github.com/howden/cham/std"
+	"github.com/pkg/errors"
 	"strings"
+	"sync"
 )
 
-// Parses a program
-func ParseProgram(src string) (*ast.Program, error) {
-	return parser.NewParser(lexer.FromString(src)).ParseProgramFully()
+// Parses a program, using the store to look up the reactions and solutions it refers to
+func ParseProgram(src string, store *eval.ReactionStore) (*ast.Program, error) {
+	program, def, err := ParseProgramOrDefinition(src, store)
+	if err != nil {
+		return nil, err
+	}
+	if def != nil {
+		return nil, errors.New("expected a program but got a definition")
+	}
+	return program, nil
 }
 
-// Parses a program or reaction definition
-func ParseProgramOrReaction(src string, store *eval.ReactionStore) (*ast.Program, *ast.ReactionPointer, error) {
-	return parser.NewParser(lexer.FromString(src)).ParseProgramOrReactionDefFully(store)
+// Parses a program, reaction definition or function definition
+func ParseProgramOrDefinition(src string, store *eval.ReactionStore) (*ast.Program, ast.Definition, error) {
+	return parser.NewParser(lexer.FromString(src)).ParseProgramOrDefinitionFully(store)
 }
 
-// Runs a program from the REPL and prints the result to STDOUT
-func HandleReplInput(src string, store *eval.ReactionStore) {
-	program, reactionDef, err := ParseProgramOrReaction(src, store)
-	if err != nil {
-		parser.PrintParserError(src, err)
-		return
+// Runs the statements entered into the REPL and prints the result of each to STDOUT
+// If trace is true, each step taken during evaluation is also printed.
+func HandleReplInput(src string, store *eval.ReactionStore, trace bool) {
+	runStatements(src, "", store, trace, true)
+}
+
+// Runs each statement in the src, and prints the result of each program to STDOUT.
+// The file name is used to resolve imports, and is empty if the src was entered into the REPL.
+// If trace is true, each step taken during evaluation is also printed, and if repl is true, "OK" is printed for each
+// definition. Stops at the first error, and returns whether all the statements were run.
+func runStatements(src string, fileName string, store *eval.ReactionStore, trace bool, repl bool) bool {
+	lex := lexer.FromString(src)
+	if fileName != "" {
+		lex = lexer.FromReader(strings.NewReader(src), fileName)
 	}
 
-	if program != nil {
-		result, err := eval.Evaluate(program)
+	p := parser.NewParser(lex)
+	for {
+		program, def, err := p.ParseStatement(store)
 		if err != nil {
-			fmt.Printf("error evaluating: %s\n", err)
-		} else {
+			parser.PrintParserError(src, err)
+			return false
+		}
+
+		if program != nil {
+			evaluator, printSummary := &eval.Evaluator{}, func() {}
+			if trace {
+				evaluator, printSummary = newTracingEvaluator()
+			}
+			evaluator.Store = store
+
+			result, err := evaluator.Evaluate(program)
+			if err != nil {
+				fmt.Printf("error evaluating: %s\n", err)
+				return false
+			}
+			printSummary()
+			storeResult(program, result, store)
 			fmt.Println(result)
+		} else if imp, ok := def.(*ast.Import); ok {
+			if err := parser.Import(imp, fileName, store); err != nil {
+				fmt.Println(err)
+				return false
+			}
+			if repl {
+				fmt.Println("OK")
+			}
+		} else if def != nil {
+			store.Define(def)
+			if repl {
+				fmt.Println("OK")
+			}
+		} else {
+			return true
 		}
-	} else if reactionDef != nil {
-		store.Put(reactionDef)
-		fmt.Println("OK")
 	}
 }
 
-// Runs a program and prints the result to STDOUT
+// Creates a new store, with the standard library loaded
+func newStore() *eval.ReactionStore {
+	store := eval.NewReactionStore()
+	if err := std.Load(store); err != nil {
+		fmt.Println(err)
+	}
+	return store
+}
+
+// Stores the result of a program as the last result (_), and under the name of the program if it has one
+func storeResult(program *ast.Program, result *eval.Multiset, store *eval.ReactionStore) {
+	store.PutSolution(ast.Ident("_"), result)
+	if program.Name != nil {
+		store.PutSolution(*program.Name, result)
+	}
+}
+
+// Runs a program and prints the result to STDOUT.
+// The standard library is available to the program.
 func HandleCmdLineInput(src string) {
-	program, err := ParseProgram(src)
+	store := newStore()
+	program, err := ParseProgram(src, store)
 	if err != nil {
 		parser.PrintParserError(src, err)
 		return
 	}
 
-	result, err := eval.Evaluate(program)
+	result, err := (&eval.Evaluator{Store: store}).Evaluate(program)
 	if err != nil {
 		fmt.Printf("error evaluating: %s\n", err)
 		return
@@ -57,38 +123,64 @@ func HandleCmdLineInput(src string) {
 	fmt.Println(result)
 }
 
-// Runs a program loaded from a file and prints the result to STDOUT
-func HandleFileInput(lines []string, store *eval.ReactionStore) {
-	for _, src := range lines {
-		src = strings.Trim(src, " \n\t")
-		if len(src) == 0 {
-			continue
-		}
+// Runs the statements loaded from a file and prints the result of each program to STDOUT
+// Returns whether all the statements were run without error.
+func HandleFileInput(src string, fileName string, store *eval.ReactionStore) bool {
+	return runStatements(src, fileName, store, false, false)
+}
 
-		program, reactionDef, err := ParseProgramOrReaction(src, store)
-		if err != nil {
-			parser.PrintParserError(src, err)
-			return
-		}
+// Runs a program and prints each step taken during evaluation, followed by the result
+func PrintTraceOutput(src string) {
+	fmt.Println("Trace Output:")
+	store := newStore()
+	program, err := ParseProgram(src, store)
+	if err != nil {
+		parser.PrintParserError(src, err)
+		return
+	}
 
-		if program != nil {
-			result, err := eval.Evaluate(program)
-			if err != nil {
-				fmt.Printf("error evaluating: %s\n", err)
-				return
+	evaluator, printSummary := newTracingEvaluator()
+	evaluator.Store = store
+	result, err := evaluator.Evaluate(program)
+	if err != nil {
+		fmt.Printf("error evaluating: %s\n", err)
+		return
+	}
+
+	printSummary()
+	fmt.Println(result)
+}
+
+// Creates an evaluator which prints each step taken during evaluation.
+// The returned function prints a summary of the number of structural and reaction steps.
+func newTracingEvaluator() (*eval.Evaluator, func()) {
+	var mutex sync.Mutex
+	structural, reactions := 0, 0
+
+	evaluator := &eval.Evaluator{
+		Trace: func(step eval.Step) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			if step.Kind.IsStructural() {
+				structural++
 			} else {
-				fmt.Println(result)
+				reactions++
 			}
-		} else if reactionDef != nil {
-			store.Put(reactionDef)
-		}
+			fmt.Println(step)
+		},
+	}
+
+	printSummary := func() {
+		fmt.Printf("(%d structural steps, %d reaction steps)\n", structural, reactions)
 	}
+	return evaluator, printSummary
 }
 
 // Runs a program through the parser and prints the resultant AST
 func PrintParserOutput(src string) {
 	fmt.Println("Parser Output:")
-	prog, err := ParseProgram(src)
+	prog, err := ParseProgram(src, newStore())
 	if err != nil {
 		parser.PrintParserError(src, err)
 	} else {
@@ -0,0 +1,62 @@
+package repl
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Returns what the function prints to STDOUT
+func captureOutput(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+
+	f()
+	w.Close()
+
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestCmdLineInput(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"{1, 2, 3} | x, y => x + y", "[6]"},
+		// the standard library can be used without being loaded
+		{"{1, 2, 3} | :sum", "[6]"},
+		{"{4, 8, 1} | :std.max", "[8]"},
+		{"{1} | :undefined", "error evaluating: error resolving reactions: undefined reaction :undefined"},
+		{"max: x, y => x if x > y", "expected a program but got a definition"},
+	}
+
+	for _, test := range tests {
+		actual := captureOutput(t, func() {
+			HandleCmdLineInput(test.src)
+		})
+		if actual = strings.TrimSpace(actual); actual != test.expected {
+			t.Errorf("incorrect output for %q. expected=%q, got=%q", test.src, test.expected, actual)
+		}
+	}
+
+	trace := captureOutput(t, func() {
+		PrintTraceOutput("{1, 2, 3} | :sum")
+	})
+	if !strings.HasSuffix(trace, "(0 structural steps, 2 reaction steps)\n[6]\n") {
+		t.Errorf("incorrect trace output. got=%q", trace)
+	}
+}
@@ -2,16 +2,26 @@ package repl
 
 import (
 	"fmt"
+	"github.com/howden/cham/ast"
 	"github.com/howden/cham/eval"
+	"github.com/howden/cham/lexer"
 	"github.com/howden/cham/parser"
 	"github.com/manifoldco/promptui"
+	"sort"
 	"strings"
 )
 
 // Runs the REPL (read eval print loop)
-func StartRepl() {
+// If a session file is given, the definitions saved in it are restored on startup, and the contents of the store are
+// saved back to it after each input.
+func StartRepl(session string) {
 	fmt.Println("CHAM Interpreter v1.0")
-	store := eval.NewReactionStore()
+	store := newStore()
+	trace := false
+
+	if session != "" {
+		restoreSession(store, session)
+	}
 
 	for {
 		input, err := getInput(store)
@@ -34,28 +44,53 @@ func StartRepl() {
 				}
 
 				path := args[0]
-				lines, err := readLines(path)
+				src, err := readFile(path)
 				if err != nil {
 					fmt.Printf("error reading from file: %s\n", err)
 					continue
 				}
 
-				HandleFileInput(lines, store)
-				fmt.Println("OK")
+				if HandleFileInput(src, path, store) {
+					fmt.Println("OK")
+				}
+
+			} else if command == "save" {
+				// save command
+				if len(args) == 0 {
+					fmt.Println("You need to specify a filename!")
+					continue
+				}
+
+				if err := saveStore(store, args[0]); err != nil {
+					fmt.Printf("error saving to file: %s\n", err)
+				} else {
+					fmt.Println("OK")
+				}
 
 			} else if command == "s" || command == "store" {
 				// store command
-				definitions := store.Slice()
-				fmt.Printf("Showing all stored reactions: (%v)\n", len(definitions))
-				for _, def := range definitions {
-					fmt.Printf("- :%v\n", def.Identifier.Name())
+				printStore(store)
+
+			} else if command == "t" || command == "trace" {
+				// trace command
+				trace = !trace
+				if trace {
+					fmt.Println("Tracing enabled")
+				} else {
+					fmt.Println("Tracing disabled")
 				}
 
 			} else {
 				fmt.Printf("unknown command: %s\n", command)
 			}
 		} else {
-			HandleReplInput(input, store)
+			HandleReplInput(input, store, trace)
+		}
+
+		if session != "" {
+			if err := saveStore(store, session); err != nil {
+				fmt.Printf("error saving session: %s\n", err)
+			}
 		}
 	}
 }
@@ -65,27 +100,74 @@ func validateInput(input string, store *eval.ReactionStore) error {
 	if isCommand {
 		if command == "q" || command == "quit" ||
 			command == "s" || command == "store" ||
-			command == "l" || command == "load" {
+			command == "l" || command == "load" ||
+			command == "save" ||
+			command == "t" || command == "trace" {
 			return nil
 		} else {
 			return fmt.Errorf("unknown command: %s", command)
 		}
 	}
 
-	// program
-	_, _, err := ParseProgramOrReaction(input, store)
-	err = parser.FormatErrorWithParserLocation(err)
-	return err
+	// the statement is continued on the next line, so it can't be checked yet
+	if isIncomplete(input) {
+		return nil
+	}
+
+	// statements
+	p := parser.NewParser(lexer.FromString(input))
+	for {
+		program, def, err := p.ParseStatement(store)
+		if err != nil {
+			return parser.FormatErrorWithParserLocation(err)
+		}
+		if program == nil && def == nil {
+			return nil
+		}
+	}
+}
+
+// Tests whether the last statement in the input continues onto the next line
+func isIncomplete(input string) bool {
+	lex := lexer.FromString(input)
+	if _, err := lex.RemainingTokens(); err != nil {
+		return false
+	}
+	return lex.Continues()
 }
 
-// Prompts for input from the terminal
+// Prompts for input from the terminal.
+// If the statement continues onto the next line (see lexer.NextToken), further lines are read until it is complete,
+// or a blank line is entered.
 func getInput(store *eval.ReactionStore) (string, error) {
+	input, err := promptLine(">", func(line string) error {
+		return validateInput(line, store)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	for isIncomplete(input) {
+		line, err := promptLine("|", func(line string) error {
+			return validateInput(input+"\n"+line, store)
+		})
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		input += "\n" + line
+	}
+	return input, nil
+}
+
+// Prompts for a single line of input from the terminal, with the given label
+func promptLine(label string, validate func(line string) error) (string, error) {
 	bold := promptui.Styler(promptui.FGBold)
 	prompt := promptui.Prompt{
-		Label: ">",
-		Validate: func(input string) error {
-			return validateInput(input, store)
-		},
+		Label:    label,
+		Validate: validate,
 		Templates: &promptui.PromptTemplates{
 			Prompt:  fmt.Sprintf("%s {{ . | bold }} ", bold(promptui.IconInitial)),
 			Valid:   fmt.Sprintf("%s {{ . | bold }} ", bold(promptui.IconGood)),
@@ -115,3 +197,76 @@ func parseCommand(input string) (bool, string, []string) {
 
 	return true, command[1:], args[1:]
 }
+
+// Prints the reactions, functions, modules and solutions in the store.
+// The definitions in the standard library are listed separately, along with whether they are shadowed by a user
+// definition with the same name.
+func printStore(store *eval.ReactionStore) {
+	var definitions, stdDefinitions []*ast.ReactionPointer
+	for _, def := range store.Slice() {
+		if eval.IsStd(def.Identifier) {
+			stdDefinitions = append(stdDefinitions, def)
+		} else {
+			definitions = append(definitions, def)
+		}
+	}
+
+	fmt.Printf("Showing all stored reactions: (%v)\n", len(definitions))
+	for _, def := range definitions {
+		fmt.Printf("- :%v\n", definitionName(def))
+	}
+
+	functions := store.Functions()
+	fmt.Printf("Showing all stored functions: (%v)\n", len(functions))
+	for _, def := range functions {
+		fmt.Printf("- fn %v\n", def.Signature())
+	}
+
+	var modules []*eval.Module
+	for _, module := range store.Modules() {
+		if module.Namespace != eval.StdNamespace {
+			modules = append(modules, module)
+		}
+	}
+	fmt.Printf("Showing all imported modules: (%v)\n", len(modules))
+	for _, module := range modules {
+		fmt.Printf("- %v as %v\n", module.Path, module.Namespace)
+	}
+
+	names := store.SolutionNames()
+	fmt.Printf("Showing all stored solutions: (%v)\n", len(names))
+	for _, name := range names {
+		solution, _ := store.GetSolution(name)
+		if name.Name() == "_" {
+			fmt.Printf("- _ = %v\n", solution)
+		} else {
+			fmt.Printf("- $%v = %v\n", name.Name(), solution)
+		}
+	}
+
+	sort.Slice(stdDefinitions, func(i, j int) bool {
+		return stdDefinitions[i].Identifier.Name() < stdDefinitions[j].Identifier.Name()
+	})
+	fmt.Printf("Showing all standard library reactions: (%v)\n", len(stdDefinitions))
+	for _, def := range stdDefinitions {
+		name := strings.TrimPrefix(definitionName(def), eval.StdNamespace+".")
+		if store.IsShadowed(def.Identifier) {
+			fmt.Printf("- :%v (shadowed, use :%v)\n", name, def.Identifier.Name())
+		} else {
+			fmt.Printf("- :%v\n", name)
+		}
+	}
+}
+
+// Returns the name of a reaction definition, including any parameters
+func definitionName(def *ast.ReactionPointer) string {
+	if len(def.Parameters) == 0 {
+		return def.Identifier.Name()
+	}
+
+	params := make([]string, 0, len(def.Parameters))
+	for _, param := range def.Parameters {
+		params = append(params, param.Name())
+	}
+	return fmt.Sprintf("%s(%s)", def.Identifier.Name(), strings.Join(params, ", "))
+}
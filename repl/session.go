@@ -0,0 +1,114 @@
+package repl
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/eval"
+	"github.com/pkg/errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Writes the contents of the store to the file at the given path, as cham source code which can be loaded again
+func saveStore(store *eval.ReactionStore, path string) error {
+	src, err := storeSource(store)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(src), 0644)
+}
+
+// Returns the source code of the imports, definitions and named solutions in the store, one statement per line.
+//
+// The standard library isn't included, and neither are the definitions made by imported modules, as these are defined
+// again by the import statements. The last result (_) isn't included either.
+func storeSource(store *eval.ReactionStore) (string, error) {
+	var statements []string
+
+	// the definitions made by each module, which are replaced by the import statement of the module
+	imported := make(map[ast.Definition]bool)
+
+	modules := store.Modules()
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].Namespace < modules[j].Namespace
+	})
+	for _, module := range modules {
+		for _, def := range module.Definitions {
+			imported[def] = true
+		}
+
+		// a module imported by another module is imported again by that module
+		if module.Namespace == eval.StdNamespace || strings.Contains(module.Namespace, ".") {
+			continue
+		}
+		statements = append(statements, ast.Source(&ast.Import{Path: module.Path, Namespace: module.Namespace}))
+	}
+
+	var defs []ast.Definition
+	for _, def := range store.Slice() {
+		if !imported[def] {
+			defs = append(defs, def)
+		}
+	}
+	for _, def := range store.Functions() {
+		if !imported[def] {
+			defs = append(defs, def)
+		}
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return definitionIdent(defs[i]).Name() < definitionIdent(defs[j]).Name()
+	})
+	for _, def := range defs {
+		statements = append(statements, ast.Source(def))
+	}
+
+	names := store.SolutionNames()
+	sort.Slice(names, func(i, j int) bool {
+		return names[i].Name() < names[j].Name()
+	})
+	for _, name := range names {
+		if name.Name() == "_" {
+			continue
+		}
+
+		solution, _ := store.GetSolution(name)
+		src, err := solution.Source()
+		if err != nil {
+			return "", errors.Wrapf(err, "error saving solution %s", name.Name())
+		}
+		statements = append(statements, fmt.Sprintf("%s = %s", name.Name(), src))
+	}
+
+	if len(statements) == 0 {
+		return "", nil
+	}
+	return strings.Join(statements, "\n") + "\n", nil
+}
+
+// Returns the identifier of a reaction or function definition
+func definitionIdent(def ast.Definition) ast.Identifier {
+	switch def := def.(type) {
+	case *ast.ReactionPointer:
+		return def.Identifier
+	case *ast.FunctionDefinition:
+		return def.Identifier
+	}
+	return ast.Ident("")
+}
+
+// Restores the session saved in the file at the given path, if it exists
+func restoreSession(store *eval.ReactionStore, path string) {
+	src, err := readFile(path)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("error reading session: %s\n", err)
+		return
+	}
+
+	if HandleFileInput(src, path, store) {
+		fmt.Printf("Restored session from %s\n", path)
+	}
+}
@@ -0,0 +1,16 @@
+// Package std provides the standard library - the sample reaction definitions from the documentation, which are
+// available in the REPL, files and one-off programs without being loaded.
+package std
+
+import (
+	"github.com/howden/cham/docs"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/parser"
+	"github.com/pkg/errors"
+)
+
+// Loads the standard library into the store, in the std namespace
+func Load(store *eval.ReactionStore) error {
+	err := parser.LoadModule(eval.StdNamespace, eval.StdNamespace, docs.Programs, store)
+	return errors.Wrap(err, "error loading standard library")
+}
@@ -0,0 +1,122 @@
+package std
+
+import (
+	"fmt"
+	"github.com/howden/cham/ast"
+	"github.com/howden/cham/eval"
+	"github.com/howden/cham/lexer"
+	"github.com/howden/cham/parser"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	store := eval.NewReactionStore()
+	if err := Load(store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	defs := store.Slice()
+	if len(defs) == 0 {
+		t.Fatalf("expected the standard library to define reactions")
+	}
+	for _, def := range defs {
+		if !eval.IsStd(def.Identifier) {
+			t.Errorf("expected %s to be defined in the std namespace", def.Identifier.Name())
+		}
+	}
+
+	// std definitions can be referred to with or without the namespace
+	for _, name := range []string{"max", "std.max", "prime_sieve", "std.sort"} {
+		if _, err := store.Get(ast.Ident(name)); err != nil {
+			t.Errorf("expected %s to be defined: %v", name, err)
+		}
+	}
+}
+
+func TestStdShadowing(t *testing.T) {
+	store := eval.NewReactionStore()
+	if err := Load(store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, definition, err := parser.NewParser(lexer.FromString("max: x, y => y if x > y")).ParseProgramOrDefinitionFully(store)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	store.Define(definition)
+
+	if !store.IsShadowed(ast.Ident("std.max")) || store.IsShadowed(ast.Ident("std.min")) || store.IsShadowed(ast.Ident("max")) {
+		t.Errorf("incorrect result for IsShadowed")
+	}
+	if def, _ := store.Get(ast.Ident("max")); def != definition {
+		t.Errorf("expected the user definition to shadow the std definition")
+	}
+}
+
+func TestModuleReferences(t *testing.T) {
+	store := eval.NewReactionStore()
+	if err := Load(store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dir := t.TempDir()
+	lib := `max: x, y => y if x > y
+local_max: :max
+std_max: :std.max
+mysort: :sort
+fn half(x) = x / 2
+scaled: x => twice(half(x)) if x % 2 == 1
+`
+	if err := os.WriteFile(filepath.Join(dir, "lib.cham"), []byte(lib), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// a module can refer to definitions outside of it, which are defined when it is used
+	for _, src := range []string{`import "lib.cham" as l`, "fn twice(x) = x * 2"} {
+		_, def, err := parser.NewParser(lexer.FromString(src)).ParseProgramOrDefinitionFully(store)
+		if err != nil {
+			t.Fatalf("error parsing %q: %v", src, err)
+		}
+		if imp, ok := def.(*ast.Import); ok {
+			err = parser.Import(imp, filepath.Join(dir, "main.cham"), store)
+		} else {
+			store.Define(def)
+		}
+		if err != nil {
+			t.Fatalf("error running %q: %v", src, err)
+		}
+	}
+
+	// the definitions of the module are looked up first, then the names outside of it and in the std namespace
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"{1, 2, 3} | :l.local_max", "[1]"},
+		{"{1, 2, 3} | :l.std_max", "[3]"},
+		{"{3, 1, 2} | :l.mysort", "[[0 1] [1 2] [2 3]]"},
+		{"{4, 7} | :l.scaled", "[4 6]"},
+	}
+	for _, test := range tests {
+		program, _, err := parser.NewParser(lexer.FromString(test.src)).ParseProgramOrDefinitionFully(store)
+		if err != nil {
+			t.Fatalf("error parsing %q: %v", test.src, err)
+		}
+		result, err := (&eval.Evaluator{Store: store}).Evaluate(program)
+		if err != nil {
+			t.Errorf("error running %q: %v", test.src, err)
+			continue
+		}
+		var molecules []string
+		for _, molecule := range result.Slice() {
+			molecules = append(molecules, molecule.String())
+		}
+		sort.Strings(molecules)
+		if actual := fmt.Sprint(molecules); actual != test.expected {
+			t.Errorf("incorrect result for %q. expected=%s, got=%s", test.src, test.expected, actual)
+		}
+	}
+}
@@ -9,10 +9,25 @@ const (
 	Invalid
 	Ident
 	Number
-	ReactionChain      // |
+	String
+	ReactionChain      // | (or bitwise or)
 	ReactionDef        // :
+	SolutionRef        // $
+	Assign             // =
 	ReactionOp         // =>
+	HeatingOp          // ~>
+	CoolingOp          // <~
+	ReversibleOp       // <~>
+	AirlockOp          // <|
 	If                 // if
+	Then               // then
+	Else               // else
+	Where              // where
+	Once               // once
+	Split              // split
+	Fn                 // fn
+	Import             // import
+	As                 // as
 	LessThan           // <
 	GreaterThan        // >
 	LessThanOrEqual    // <=
@@ -27,13 +42,21 @@ const (
 	Multiply           // *
 	Divide             // /
 	Modulo             // %
+	Power              // **
+	BitwiseAnd         // &
+	BitwiseNot         // ~
+	LeftShift          // <<
+	RightShift         // >>
 	Comma              // ,
+	Range              // ..
+	Caret              // ^ (repetition, or bitwise xor)
 	OpenBracket        // (
 	CloseBracket       // )
 	OpenCurlyBracket   // {
 	CloseCurlyBracket  // }
 	OpenSquareBracket  // [
 	CloseSquareBracket // ]
+	Semicolon          // ; (or a line break which ends a statement)
 )
 
 func (t TokenType) New() Token {
@@ -53,10 +76,25 @@ var names = map[TokenType]string{
 	Invalid:            "Invalid",
 	Ident:              "ident",
 	Number:             "number",
+	String:             "string",
 	ReactionChain:      "reactionChain",
 	ReactionDef:        "reactionDef",
+	SolutionRef:        "solutionRef",
+	Assign:             "assign",
 	ReactionOp:         "reactionOp",
+	HeatingOp:          "heatingOp",
+	CoolingOp:          "coolingOp",
+	ReversibleOp:       "reversibleOp",
+	AirlockOp:          "airlockOp",
 	If:                 "if",
+	Then:               "then",
+	Else:               "else",
+	Where:              "where",
+	Once:               "once",
+	Split:              "split",
+	Fn:                 "fn",
+	Import:             "import",
+	As:                 "as",
 	LessThan:           "lessThan",
 	GreaterThan:        "greaterThan",
 	LessThanOrEqual:    "lessThanOrEqual",
@@ -71,13 +109,40 @@ var names = map[TokenType]string{
 	Multiply:           "multiply",
 	Divide:             "divide",
 	Modulo:             "modulo",
+	Power:              "power",
+	BitwiseAnd:         "bitwiseAnd",
+	BitwiseNot:         "bitwiseNot",
+	LeftShift:          "leftShift",
+	RightShift:         "rightShift",
 	Comma:              "comma",
+	Range:              "range",
+	Caret:              "caret",
 	OpenBracket:        "openBracket",
 	CloseBracket:       "closeBracket",
 	OpenCurlyBracket:   "openCurlyBracket",
 	CloseCurlyBracket:  "closeCurlyBracket",
 	OpenSquareBracket:  "openSquareBracket",
 	CloseSquareBracket: "closeSquareBracket",
+	Semicolon:          "semicolon",
+}
+
+// Identifiers which are reserved as keywords
+var Keywords = map[string]TokenType{
+	"if":     If,
+	"then":   Then,
+	"else":   Else,
+	"where":  Where,
+	"once":   Once,
+	"split":  Split,
+	"fn":     Fn,
+	"import": Import,
+	"as":     As,
+}
+
+// Returns whether the token type is a keyword
+func (t TokenType) IsKeyword() bool {
+	keyword, ok := Keywords[names[t]]
+	return ok && keyword == t
 }
 
 func (t TokenType) String() string {
@@ -89,6 +154,10 @@ type Token struct {
 	Literal    string
 	hasLiteral bool
 	Err        error
+
+	// The position of the start of the token in the source, if known (the line is 0 otherwise)
+	Line   int
+	Column int
 }
 
 func (t Token) String() string {